@@ -0,0 +1,148 @@
+package pge
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SliceArg is an argument holding a Go slice, created by In, Any or AnyOf.
+type SliceArg struct {
+	slice    interface{}
+	expand   bool
+	elemType string
+}
+
+// In returns an argument that expands slice into one placeholder per element,
+// for queries written as `WHERE id IN ($1)`. Placeholders following it are
+// renumbered to make room. The slice must not be empty.
+func In(slice interface{}) SliceArg {
+	return SliceArg{slice: slice, expand: true}
+}
+
+// Any returns an argument that passes slice as a single array parameter, for
+// queries written as `WHERE id = ANY($1)`. The placeholder is cast to the
+// postgres array type of the slice's element type when it can be inferred.
+// Strings are left uncast, since they may hold uuids, enums or other types
+// postgres infers from the column they are compared with.
+func Any(slice interface{}) SliceArg {
+	return SliceArg{slice: slice}
+}
+
+// AnyOf is like Any, but casts the placeholder to an array of elemType, such
+// as "uuid", for parameters postgres cannot infer the type of.
+func AnyOf(slice interface{}, elemType string) SliceArg {
+	return SliceArg{slice: slice, elemType: elemType}
+}
+
+// typeName matches the type names AnyOf accepts, which are inserted into the
+// query unquoted.
+var typeName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?( [A-Za-z_][A-Za-z0-9_]*)*$`)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// arrayType returns the postgres array type for the elements of t, or "" if
+// the type should be left for postgres to infer.
+func arrayType(t reflect.Type) string {
+	if t == timeType {
+		return "timestamptz[]"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "bool[]"
+	case reflect.Int, reflect.Int64, reflect.Uint32:
+		return "int8[]"
+	case reflect.Int32, reflect.Uint16:
+		return "int4[]"
+	case reflect.Int8, reflect.Int16:
+		return "int2[]"
+	case reflect.Uint8:
+		// pgx sends a []byte as bytea rather than an array, so it must not
+		// be cast.
+		return ""
+	case reflect.Float32:
+		return "float4[]"
+	case reflect.Float64:
+		return "float8[]"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "bytea[]"
+		}
+	}
+	return ""
+}
+
+// expandArgs rewrites the placeholders of SliceArg arguments in sql and
+// flattens the arguments to match.
+func expandArgs(sql string, args []interface{}) (string, []interface{}, error) {
+	hasSlice := false
+	for _, arg := range args {
+		if _, ok := arg.(SliceArg); ok {
+			hasSlice = true
+			break
+		}
+	}
+	if !hasSlice {
+		return sql, args, nil
+	}
+
+	// placeholders maps each original parameter number to its replacement.
+	placeholders := make([]string, len(args)+1)
+	var expanded []interface{}
+	for i, arg := range args {
+		param := len(expanded) + 1
+		sliceArg, ok := arg.(SliceArg)
+		if !ok {
+			placeholders[i+1] = "$" + strconv.Itoa(param)
+			expanded = append(expanded, arg)
+			continue
+		}
+
+		v := reflect.ValueOf(sliceArg.slice)
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			return "", nil, fmt.Errorf("argument $%d is not a slice: %T", i+1, sliceArg.slice)
+		}
+
+		if !sliceArg.expand {
+			placeholders[i+1] = "$" + strconv.Itoa(param)
+			typ := arrayType(v.Type().Elem())
+			if sliceArg.elemType != "" {
+				if !typeName.MatchString(sliceArg.elemType) {
+					return "", nil, fmt.Errorf("argument $%d has invalid element type %q", i+1, sliceArg.elemType)
+				}
+				typ = sliceArg.elemType + "[]"
+			}
+			if typ != "" {
+				placeholders[i+1] += "::" + typ
+			}
+			expanded = append(expanded, sliceArg.slice)
+			continue
+		}
+
+		if v.Len() == 0 {
+			return "", nil, fmt.Errorf("argument $%d is an empty In list, use Any for slices that may be empty", i+1)
+		}
+		params := make([]string, v.Len())
+		for j := range params {
+			params[j] = "$" + strconv.Itoa(param+j)
+			expanded = append(expanded, v.Index(j).Interface())
+		}
+		placeholders[i+1] = strings.Join(params, ", ")
+	}
+
+	var err error
+	sql = rewritePlaceholders(sql, func(n int) string {
+		if n < 1 || n >= len(placeholders) {
+			err = fmt.Errorf("placeholder $%d has no matching argument", n)
+			return "$" + strconv.Itoa(n)
+		}
+		return placeholders[n]
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return sql, expanded, nil
+}
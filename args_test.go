@@ -0,0 +1,112 @@
+package pge
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExpandArgs(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		sql      string
+		args     []interface{}
+		want     string
+		wantArgs []interface{}
+	}{
+		{
+			name:     "no slices",
+			sql:      "SELECT * FROM t WHERE a = $1",
+			args:     []interface{}{1},
+			want:     "SELECT * FROM t WHERE a = $1",
+			wantArgs: []interface{}{1},
+		},
+		{
+			name:     "in",
+			sql:      "SELECT * FROM t WHERE a IN ($1) AND b = $2",
+			args:     []interface{}{In([]int{1, 2, 3}), "b"},
+			want:     "SELECT * FROM t WHERE a IN ($1, $2, $3) AND b = $4",
+			wantArgs: []interface{}{1, 2, 3, "b"},
+		},
+		{
+			name:     "any int",
+			sql:      "SELECT * FROM t WHERE a = ANY($1)",
+			args:     []interface{}{Any([]int64{1})},
+			want:     "SELECT * FROM t WHERE a = ANY($1::int8[])",
+			wantArgs: []interface{}{[]int64{1}},
+		},
+		{
+			name:     "any time",
+			sql:      "SELECT * FROM t WHERE a = ANY($1)",
+			args:     []interface{}{Any([]time.Time{})},
+			want:     "SELECT * FROM t WHERE a = ANY($1::timestamptz[])",
+			wantArgs: []interface{}{[]time.Time{}},
+		},
+		{
+			name:     "any string",
+			sql:      "SELECT * FROM t WHERE id = ANY($1)",
+			args:     []interface{}{Any([]string{"a"})},
+			want:     "SELECT * FROM t WHERE id = ANY($1)",
+			wantArgs: []interface{}{[]string{"a"}},
+		},
+		{
+			name:     "any bytes",
+			sql:      "SELECT * FROM t WHERE id = ANY($1)",
+			args:     []interface{}{Any([]byte("a"))},
+			want:     "SELECT * FROM t WHERE id = ANY($1)",
+			wantArgs: []interface{}{[]byte("a")},
+		},
+		{
+			name:     "any of",
+			sql:      "SELECT * FROM t WHERE id = ANY($1)",
+			args:     []interface{}{AnyOf([]string{"a"}, "uuid")},
+			want:     "SELECT * FROM t WHERE id = ANY($1::uuid[])",
+			wantArgs: []interface{}{[]string{"a"}},
+		},
+		{
+			name:     "any of qualified",
+			sql:      "SELECT * FROM t WHERE status = ANY($1)",
+			args:     []interface{}{AnyOf([]string{"a"}, "billing.status")},
+			want:     "SELECT * FROM t WHERE status = ANY($1::billing.status[])",
+			wantArgs: []interface{}{[]string{"a"}},
+		},
+		{
+			name:     "any of multiple words",
+			sql:      "SELECT * FROM t WHERE a = ANY($1)",
+			args:     []interface{}{AnyOf([]float64{1}, "double precision")},
+			want:     "SELECT * FROM t WHERE a = ANY($1::double precision[])",
+			wantArgs: []interface{}{[]float64{1}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, args, err := expandArgs(tc.sql, tc.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("expandArgs() sql = %q, want %q", got, tc.want)
+			}
+			if !reflect.DeepEqual(args, tc.wantArgs) {
+				t.Errorf("expandArgs() args = %v, want %v", args, tc.wantArgs)
+			}
+		})
+	}
+}
+
+func TestExpandArgsErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		args []interface{}
+	}{
+		{"empty in", []interface{}{In([]int{})}},
+		{"not a slice", []interface{}{Any(1)}},
+		{"invalid element type", []interface{}{AnyOf([]string{"a"}, "uuid[]); DROP TABLE t; --")}},
+		{"missing argument", []interface{}{Any([]int{1}), 2}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, _, err := expandArgs("SELECT $1 = ANY($3)", tc.args); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+// Command pge generates typed Go wrappers for queries kept in annotated .sql
+// files.
+//
+// Usage:
+//
+//	pge generate -db <postgres-uri> [-pkg name] [-out file] <dir>
+//
+// Every .sql file in dir is loaded with pge.LoadQueries and described against
+// the database, which must have the schema the queries expect. The generated
+// file embeds the .sql files, so it is written to dir.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/hinshun/pge"
+	"github.com/hinshun/pge/gen"
+	pgx "github.com/jackc/pgx/v4"
+)
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "generate" {
+		log.Fatal("usage: pge generate -db <postgres-uri> [-pkg name] [-out file] <dir>")
+	}
+
+	err := generate(context.Background(), os.Args[2:])
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func generate(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("generate", flag.ExitOnError)
+	uri := flags.String("db", os.Getenv("DATABASE_URL"), "postgres uri used to describe the queries")
+	pkg := flags.String("pkg", "", "package name, defaults to the directory name")
+	out := flags.String("out", "queries.gen.go", "name of the generated file within dir")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("generate expects exactly 1 arg <dir>")
+	}
+	dir := flags.Arg(0)
+
+	if *pkg == "" {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		*pkg = filepath.Base(abs)
+	}
+
+	queries, err := pge.LoadQueries(os.DirFS(dir))
+	if err != nil {
+		return err
+	}
+
+	cfg := gen.Config{
+		Package:      *pkg,
+		EmbedPattern: "*.sql",
+	}
+	for _, q := range queries {
+		cfg.Queries = append(cfg.Queries, q)
+	}
+
+	conn, err := pgx.Connect(ctx, *uri)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+
+	src, err := gen.Generate(ctx, conn, cfg)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, *out), src, 0644)
+}
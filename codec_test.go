@@ -0,0 +1,134 @@
+package pge
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestSignedCursorCodec(t *testing.T) {
+	oldKey := SigningKey{ID: 1, Secret: []byte("old secret")}
+	newKey := SigningKey{ID: 2, Secret: []byte("new secret")}
+
+	old, err := NewSignedCursorCodec(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := NewSignedCursorCodec(newKey, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retired, err := NewSignedCursorCodec(newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cursor, err := old.Encode(`["2021-01-01T00:00:00Z","42"]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		got, err := old.Decode(cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != `["2021-01-01T00:00:00Z","42"]` {
+			t.Errorf("Decode() = %q", got)
+		}
+	})
+
+	t.Run("rotated key", func(t *testing.T) {
+		if _, err := rotated.Decode(cursor); err != nil {
+			t.Errorf("cursor signed by an old key was rejected: %s", err)
+		}
+
+		signed, err := rotated.Encode("42")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := old.Decode(signed); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("cursor signed by an unknown key was accepted: %v", err)
+		}
+	})
+
+	t.Run("retired key", func(t *testing.T) {
+		if _, err := retired.Decode(cursor); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("cursor signed by a retired key was accepted: %v", err)
+		}
+	})
+
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tamper := func(i int) string {
+		tampered := append([]byte(nil), b...)
+		tampered[i] ^= 1
+		return base64.RawURLEncoding.EncodeToString(tampered)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		cursor string
+	}{
+		{"tampered version", tamper(0)},
+		{"tampered key id", tamper(1)},
+		{"tampered payload", tamper(5)},
+		{"tampered signature", tamper(len(b) - 1)},
+		{"truncated", cursor[:10]},
+		{"malformed", "not base64!"},
+		{"empty", ""},
+		{"unsigned", base64.RawURLEncoding.EncodeToString([]byte("42"))},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := old.Decode(tc.cursor)
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("Decode(%q) = %v, want ErrInvalidCursor", tc.cursor, err)
+			}
+		})
+	}
+}
+
+func TestNewSignedCursorCodecErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		keys []SigningKey
+	}{
+		{"no keys", nil},
+		{"empty secret", []SigningKey{{ID: 1}}},
+		{"duplicate id", []SigningKey{{ID: 1, Secret: []byte("a")}, {ID: 1, Secret: []byte("b")}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := NewSignedCursorCodec(tc.keys...); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestCursorFromStringCodec(t *testing.T) {
+	codec, err := NewSignedCursorCodec(SigningKey{ID: 1, Secret: []byte("secret")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := newQuery("test cursor codec", "SELECT 1",
+		WithCursorColumns(CursorKey{"name", Ascending}, CursorKey{"id", Ascending}),
+		WithCursorCodec(codec))
+
+	cursor, err := codec.Encode(`["bob","3"]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args, err := q.cursorArguments(cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 2 || args[0] != "bob" || args[1] != "3" {
+		t.Errorf("cursorArguments() = %v", args)
+	}
+
+	if _, err := q.cursorArguments(`["bob","3"]`); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("unsigned cursor was accepted: %v", err)
+	}
+}
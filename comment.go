@@ -0,0 +1,118 @@
+package pge
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+type commentTagsKey struct{}
+
+// WithQueryComments appends a sqlcommenter style comment to every statement
+// executed by the store, so that statements seen in pg_stat_activity or the
+// slow query log can be traced back to their Query:
+//
+//	SELECT * FROM customers /*query='select%20customers',service='billing'*/
+//
+// The comment is tagged with the Query.Name, the given static tags and any
+// tags added to the context with ContextWithCommentTags. Keys and values are
+// percent-encoded so they cannot terminate the comment or the statement.
+//
+// Statements carrying context tags are sent with the simple protocol rather
+// than prepared, since their text changes with every call. See
+// ContextWithCommentTags.
+func WithQueryComments(tags map[string]string) StoreOption {
+	return func(info *StoreInfo) {
+		info.comments = true
+		info.commentTags = tags
+	}
+}
+
+// ContextWithCommentTags returns a copy of ctx carrying tags, such as route or
+// traceparent, to add to the comments of statements executed with it. Tags
+// already in ctx are kept unless overridden.
+//
+// Statements executed with tags from ctx are sent with pgx's simple protocol,
+// which interpolates arguments into the statement on the client, instead of
+// being prepared. Preparing them would cost a round trip and a statement
+// cache entry on every call, since their text is unique to the call.
+// Arguments must then be encodable as text, as they are when connecting
+// through pgbouncer with PreferSimpleProtocol.
+func ContextWithCommentTags(ctx context.Context, tags map[string]string) context.Context {
+	merged := make(map[string]string)
+	for k, v := range commentTagsFromContext(ctx) {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, commentTagsKey{}, merged)
+}
+
+func commentTagsFromContext(ctx context.Context) map[string]string {
+	tags, _ := ctx.Value(commentTagsKey{}).(map[string]string)
+	return tags
+}
+
+// comment returns sql with its query comment appended, and whether the
+// comment includes tags from ctx.
+func (info *StoreInfo) comment(ctx context.Context, query Query, sql string) (string, bool) {
+	if info == nil || !info.comments {
+		return sql, false
+	}
+
+	ctxTags := commentTagsFromContext(ctx)
+	tags := make(map[string]string, len(info.commentTags)+len(ctxTags)+1)
+	for k, v := range info.commentTags {
+		tags[k] = v
+	}
+	for k, v := range ctxTags {
+		tags[k] = v
+	}
+	tags["query"] = query.Name
+
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("/*")
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(commentEscape(k))
+		b.WriteString("='")
+		b.WriteString(commentEscape(tags[k]))
+		b.WriteString("'")
+	}
+	b.WriteString("*/")
+
+	// The comment goes before a trailing semicolon so it stays part of the
+	// statement.
+	trimmed := strings.TrimRight(sql, "; \t\n")
+	return trimmed + " " + b.String() + sql[len(trimmed):], len(ctxTags) > 0
+}
+
+// commentEscape percent-encodes everything but unreserved characters, which
+// leaves no quotes, slashes or asterisks in the comment.
+func commentEscape(s string) string {
+	const hex = "0123456789ABCDEF"
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&15])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,49 @@
+package pge
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	pgx "github.com/jackc/pgx/v4"
+)
+
+func TestPrepareStatementComments(t *testing.T) {
+	info := &StoreInfo{comments: true, commentTags: map[string]string{"service": "billing"}}
+	query := newQuery("select customer", "SELECT * FROM customers WHERE id = $1")
+
+	for _, tc := range []struct {
+		name     string
+		ctx      context.Context
+		want     string
+		wantArgs []interface{}
+	}{
+		{
+			name:     "static tags",
+			ctx:      context.Background(),
+			want:     "SELECT * FROM customers WHERE id = $1 /*query='select%20customer',service='billing'*/",
+			wantArgs: []interface{}{1},
+		},
+		{
+			name:     "context tags",
+			ctx:      ContextWithCommentTags(context.Background(), map[string]string{"traceparent": "00-abc-01"}),
+			want:     "SELECT * FROM customers WHERE id = $1 /*query='select%20customer',service='billing',traceparent='00-abc-01'*/",
+			wantArgs: []interface{}{pgx.QuerySimpleProtocol(true), 1},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := prepareStatement(tc.ctx, info, nil, query, []interface{}{1}, func(q queryable, sql string, args []interface{}) error {
+				if sql != tc.want {
+					t.Errorf("sql = %q, want %q", sql, tc.want)
+				}
+				if !reflect.DeepEqual(args, tc.wantArgs) {
+					t.Errorf("args = %v, want %v", args, tc.wantArgs)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package pge
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WithCTE prepends `WITH name AS (sub)` to the query, after any common table
+// expressions added before it. sub is rendered immediately, its placeholders
+// are renumbered to follow the query's parameters, and args are bound to the
+// query for sub's parameters as with Where.
+func (q Query) WithCTE(name string, sub Query, args ...interface{}) Query {
+	sql, q := q.embed(sub, args)
+	q.ctes = append(q.ctes[:len(q.ctes):len(q.ctes)], name+" AS ("+sql+")")
+	return q
+}
+
+// WithSubquery sets the template parameter param to sub wrapped in
+// parentheses, renumbering its placeholders and binding args as WithCTE does.
+//
+//	q := pge.NewQuery("select top customers", `
+//		SELECT * FROM customers WHERE id IN {{.TopCustomers}}
+//	`).WithSubquery("TopCustomers", SelectTopCustomerIDs, limit)
+func (q Query) WithSubquery(param string, sub Query, args ...interface{}) Query {
+	sql, q := q.embed(sub, args)
+	return q.WithTemplateParameter(param, SQL("("+sql+")"))
+}
+
+// Union combines the query with other using UNION, renumbering other's
+// placeholders and binding args as WithCTE does.
+func (q Query) Union(other Query, args ...interface{}) Query {
+	return q.union("UNION", other, args)
+}
+
+// UnionAll combines the query with other using UNION ALL, renumbering other's
+// placeholders and binding args as WithCTE does.
+func (q Query) UnionAll(other Query, args ...interface{}) Query {
+	return q.union("UNION ALL", other, args)
+}
+
+func (q Query) union(op string, other Query, args []interface{}) Query {
+	sql, q := q.embed(other, args)
+	q.unions = append(q.unions[:len(q.unions):len(q.unions)], op+" ("+sql+")")
+	return q
+}
+
+// embed renders sub with its placeholders renumbered to follow q's
+// parameters, and binds args followed by any args bound to sub.
+func (q Query) embed(sub Query, args []interface{}) (string, Query) {
+	sql, err := sub.Render()
+	if err != nil {
+		if q.err == nil {
+			q.err = fmt.Errorf("failed to render %q: %w", sub.Name, err)
+		}
+		return "", q
+	}
+
+	sql = renumberPlaceholders(sql, q.paramCount())
+	q.args = append(q.args[:len(q.args):len(q.args)], sub.arguments(args)...)
+	return sql, q
+}
+
+// compose wraps sql with the query's unions and common table expressions.
+func (q Query) compose(sql string) string {
+	if len(q.unions) > 0 {
+		sql = "(" + sql + ") " + strings.Join(q.unions, " ")
+	}
+	if len(q.ctes) > 0 {
+		sql = "WITH " + strings.Join(q.ctes, ", ") + " " + sql
+	}
+	return sql
+}
@@ -0,0 +1,55 @@
+package pge
+
+import "testing"
+
+func TestComposeTerminatedQueries(t *testing.T) {
+	customer := newQuery("test select customer", `
+		SELECT * FROM customers WHERE id = $1;
+	`)
+	top := newQuery("test select top customers", `
+		SELECT id FROM customers ORDER BY spend DESC LIMIT $1;
+	`)
+
+	for _, tc := range []struct {
+		name string
+		q    Query
+		want string
+	}{
+		{
+			name: "terminated",
+			q:    customer,
+			want: "SELECT * FROM customers WHERE id = $1",
+		},
+		{
+			name: "cte",
+			q:    customer.WithCTE("top", top, 10),
+			want: "WITH top AS (SELECT id FROM customers ORDER BY spend DESC LIMIT $2) SELECT * FROM customers WHERE id = $1",
+		},
+		{
+			name: "union",
+			q:    newQuery("test select one", "SELECT 1;").Union(newQuery("test select two", "SELECT 2;")),
+			want: "(SELECT 1) UNION (SELECT 2)",
+		},
+		{
+			name: "subquery",
+			q: newQuery("test select in", "SELECT * FROM customers WHERE id IN {{.Top}};").
+				WithSubquery("Top", top, 10),
+			want: "SELECT * FROM customers WHERE id IN (SELECT id FROM customers ORDER BY spend DESC LIMIT $1)",
+		},
+		{
+			name: "trailing comment",
+			q:    newQuery("test select comment", "SELECT 1; -- one\n"),
+			want: "SELECT 1",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.q.Render()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("Render() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
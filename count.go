@@ -0,0 +1,83 @@
+package pge
+
+import (
+	"context"
+	"math"
+)
+
+// CountMode decides whether PaginatedSelect counts the rows matching a query
+// across all of its pages.
+type CountMode int
+
+const (
+	// NoCount leaves PageInfo.TotalCount unset.
+	NoCount CountMode = iota
+
+	// ExactCount counts the matching rows with a count(*) over the
+	// unpaginated query, which scans every matching row.
+	ExactCount
+
+	// EstimatedCount uses the planner's estimate of the rows the unpaginated
+	// query returns, which is derived from table statistics and is cheap
+	// regardless of table size. Estimates below estimatedCountThreshold are
+	// replaced by an exact count, since those are cheap to count and
+	// estimates are least accurate for them.
+	EstimatedCount
+)
+
+// estimatedCountThreshold is the estimated row count below which
+// EstimatedCount counts rows exactly.
+const estimatedCountThreshold = 1000
+
+// unsortedOrderBy fills in PaginationOrderBy when counting rows. The
+// template still needs an expression after ORDER BY, and the planner drops
+// constant sort keys, so the rows are not sorted.
+const unsortedOrderBy = "NULL::int"
+
+// unpaginated returns the query selecting every page, without sorting them.
+func (q Query) unpaginated() Query {
+	q.paginator = nil
+	q.cursorArgs = nil
+	q.lock = ""
+	q.variant = "unpaginated"
+	return q.WithTemplateParameter("PaginationWhere", SQL("true")).
+		WithTemplateParameter("PaginationOrderBy", SQL(unsortedOrderBy))
+}
+
+// countQuery returns the query counting the rows of every page.
+func (q Query) countQuery() Query {
+	q = q.unpaginated().
+		WithPrefix("SELECT count(*) FROM (").
+		WithSuffix(") counted")
+	q.variant = "count"
+	return q
+}
+
+// countRows sets the total count of info as requested by the query's
+// Paginator.
+func countRows(ctx context.Context, info *StoreInfo, q queryable, query Query, page *PageInfo, rows int, args ...interface{}) error {
+	mode := query.paginator.Count
+	if mode == NoCount {
+		return nil
+	}
+
+	// A page with no neighbours holds every row.
+	if !page.HasNextPage && !page.HasPreviousPage {
+		page.TotalCount = int64(rows)
+		return nil
+	}
+
+	if mode == EstimatedCount {
+		plan, err := pgExplain(ctx, info, q, query.unpaginated(), false, args...)
+		if err != nil {
+			return err
+		}
+		if plan.Root.PlanRows >= estimatedCountThreshold {
+			page.TotalCount = int64(math.Round(plan.Root.PlanRows))
+			page.TotalCountEstimated = true
+			return nil
+		}
+	}
+
+	return pgGet(ctx, info, q, &page.TotalCount, query.countQuery(), args...)
+}
@@ -0,0 +1,54 @@
+package pge
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCountQuery(t *testing.T) {
+	q := newQuery("test count", `
+		SELECT * FROM t WHERE a = $1 AND {{.PaginationWhere}} ORDER BY {{.PaginationOrderBy}};
+	`, WithCursorColumn("t.id", 2, Ascending), WithLocking(ForUpdate, Wait))
+
+	q, err := q.WithPaginator(&Paginator{First: 10, Cursors: Cursors{AfterCursor: "5"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err = q.withCursorArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		q        Query
+		want     string
+		wantArgs []interface{}
+	}{
+		{
+			name:     "unpaginated",
+			q:        q.unpaginated(),
+			want:     "SELECT * FROM t WHERE a = $1 AND true ORDER BY NULL::int",
+			wantArgs: []interface{}{1},
+		},
+		{
+			name:     "count",
+			q:        q.countQuery(),
+			want:     "SELECT count(*) FROM ( SELECT * FROM t WHERE a = $1 AND true ORDER BY NULL::int ) counted",
+			wantArgs: []interface{}{1},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.q.Render()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("Render() = %q, want %q", got, tc.want)
+			}
+			if args := tc.q.arguments([]interface{}{1}); !reflect.DeepEqual(args, tc.wantArgs) {
+				t.Errorf("arguments() = %v, want %v", args, tc.wantArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package pge
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// CursorKey is a column a query is paginated by and the order it is sorted
+// in.
+type CursorKey struct {
+	Column string
+	Order  Order
+}
+
+// EncodeCursor returns a cursor holding values for each column of a composite
+// cursor, which rows may return from ToCursor. Values are sent back to
+// postgres as text, so times are encoded with nanosecond precision.
+func EncodeCursor(values ...interface{}) (string, error) {
+	strs := make([]string, len(values))
+	for i, v := range values {
+		s, err := cursorValueString(v)
+		if err != nil {
+			return "", err
+		}
+		strs[i] = s
+	}
+	b, err := json.Marshal(strs)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// DecodeCursor returns the values of a cursor created by EncodeCursor.
+func DecodeCursor(cursor string) ([]string, error) {
+	var values []string
+	err := json.Unmarshal([]byte(cursor), &values)
+	if err != nil {
+		return nil, asInvalidCursor(err)
+	}
+	return values, nil
+}
+
+func cursorValueString(v interface{}) (string, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() || rv.Kind() == reflect.Ptr {
+		return "", errors.New("cursor values cannot be null")
+	}
+
+	switch v := rv.Interface().(type) {
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case []byte:
+		return string(v), nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// cursorArguments returns the arguments comparing rows against cursor, one
+// for each cursor column.
+func (q Query) cursorArguments(cursor string) ([]interface{}, error) {
+	v, err := q.CursorFromString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	if len(q.cursorKeys) <= 1 {
+		return []interface{}{v}, nil
+	}
+
+	args, ok := v.([]interface{})
+	if !ok || len(args) != len(q.cursorKeys) {
+		return nil, invalidCursor("expected %d values", len(q.cursorKeys))
+	}
+	return args, nil
+}
+
+// withCursorArgs binds the arguments of the paginator's cursor, if any, to
+// the query.
+func (q Query) withCursorArgs() (Query, error) {
+	if q.paginator == nil {
+		return q, nil
+	}
+
+	cursor := q.paginator.AfterCursor
+	if cursor == "" {
+		cursor = q.paginator.BeforeCursor
+	}
+	if cursor == "" {
+		return q, nil
+	}
+
+	args, err := q.cursorArguments(cursor)
+	if err != nil {
+		return q, err
+	}
+	q.cursorArgs = args
+	return q, nil
+}
+
+// cursorFromRow returns the cursor of a row encoded by the query's codec.
+func (q Query) cursorFromRow(v reflect.Value) (string, error) {
+	cursor, err := q.rowCursor(v)
+	if err != nil || q.cursorCodec == nil {
+		return cursor, err
+	}
+	return q.cursorCodec.Encode(cursor)
+}
+
+// rowCursor returns the cursor of a row, using its ToCursor method if it has
+// one and otherwise reading the fields matching the cursor columns.
+func (q Query) rowCursor(v reflect.Value) (string, error) {
+	if cursorMethod := v.MethodByName("ToCursor"); cursorMethod.IsValid() {
+		returnVals := cursorMethod.Call(nil)
+		if len(returnVals) != 1 || returnVals[0].Kind() != reflect.String {
+			return "", errors.New("ToCursor did not return a string")
+		}
+		return returnVals[0].String(), nil
+	}
+
+	row := reflect.Indirect(v)
+	if row.Kind() != reflect.Struct {
+		return "", errors.New("missing ToCursor method")
+	}
+
+	fields := structFields(row.Type())
+	values := make([]interface{}, len(q.cursorKeys))
+	for i, key := range q.cursorKeys {
+		col := strings.Trim(removeTablePrefix.ReplaceAllLiteralString(key.Column, ""), `"`)
+		index, ok := fields[col]
+		if !ok {
+			return "", fmt.Errorf("%s has no ToCursor method or field for cursor column %q", row.Type(), col)
+		}
+		values[i] = row.FieldByIndex(index).Interface()
+	}
+
+	if len(values) == 1 {
+		return cursorValueString(values[0])
+	}
+	return EncodeCursor(values...)
+}
@@ -0,0 +1,45 @@
+package pge
+
+import "errors"
+
+// The errors below are sentinels matched with errors.Is. The errors wrapping
+// them unwrap to the underlying error, such as the *pgconn.PgError that
+// caused them.
+var (
+	// ErrQueryTimeout is reported for queries that ran past the timeout set
+	// by WithTimeout or WithStatementTimeout.
+	ErrQueryTimeout = errors.New("query timed out")
+
+	// ErrLockNotAvailable means a query locking rows with NoWait found them
+	// already locked.
+	ErrLockNotAvailable = errors.New("lock not available")
+
+	// ErrInvalidCursor is returned for pagination cursors that cannot be
+	// decoded, including those failing signature verification.
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// sentinelError wraps err so that it matches sentinel.
+type sentinelError struct {
+	sentinel error
+	msg      string
+	err      error
+}
+
+// wrapSentinel returns err wrapped to match sentinel, and described by msg
+// followed by err's own message.
+func wrapSentinel(sentinel error, msg string, err error) error {
+	return &sentinelError{sentinel: sentinel, msg: msg, err: err}
+}
+
+func (e *sentinelError) Error() string {
+	return e.msg + ": " + e.err.Error()
+}
+
+func (e *sentinelError) Is(target error) bool {
+	return target == e.sentinel
+}
+
+func (e *sentinelError) Unwrap() error {
+	return e.err
+}
@@ -8,21 +8,20 @@ import (
 )
 
 func InsertCustomer(ctx context.Context, c pge.Conn, ct Customer) (id int64, err error) {
-	err = c.Get(ctx, &id, sql.InsertCustomer, ct.PostalCode)
+	err = c.Insert(ctx, &id, sql.InsertCustomer, ct)
 	return
 }
 
 func InsertProduct(ctx context.Context, c pge.Conn, p Product) (id int64, err error) {
-	err = c.Get(ctx, &id, sql.InsertProduct, p.ProductName, p.Price, p.Quantity)
+	err = c.Insert(ctx, &id, sql.InsertProduct, p)
 	return
 }
 
 func InsertTransaction(ctx context.Context, c pge.Conn, t Transaction) (id int64, err error) {
-	err = c.Get(ctx, &id, sql.InsertTransaction, t.CustomerID)
+	err = c.Insert(ctx, &id, sql.InsertTransaction, t)
 	return
 }
 
 func InsertProductTransaction(ctx context.Context, c pge.Conn, pt ProductTransaction) error {
-	_, err := c.Execute(ctx, sql.InsertProductTransaction, pt.ProductID, pt.TransactionID)
-	return err
+	return c.Insert(ctx, nil, sql.InsertProductTransaction, pt)
 }
@@ -0,0 +1,136 @@
+package pge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+// Plan is a query plan returned by EXPLAIN (FORMAT JSON).
+type Plan struct {
+	Root *PlanNode `json:"Plan"`
+
+	// PlanningTime and ExecutionTime are in milliseconds, and are only
+	// reported by ExplainAnalyze.
+	PlanningTime  float64 `json:"Planning Time"`
+	ExecutionTime float64 `json:"Execution Time"`
+}
+
+// PlanNode is a node of a query plan. The Actual fields are only reported by
+// ExplainAnalyze.
+type PlanNode struct {
+	NodeType     string  `json:"Node Type"`
+	RelationName string  `json:"Relation Name"`
+	Schema       string  `json:"Schema"`
+	Alias        string  `json:"Alias"`
+	IndexName    string  `json:"Index Name"`
+	JoinType     string  `json:"Join Type"`
+	StartupCost  float64 `json:"Startup Cost"`
+	TotalCost    float64 `json:"Total Cost"`
+	PlanRows     float64 `json:"Plan Rows"`
+	PlanWidth    int     `json:"Plan Width"`
+	Filter       string  `json:"Filter"`
+	IndexCond    string  `json:"Index Cond"`
+
+	ActualStartupTime float64 `json:"Actual Startup Time"`
+	ActualTotalTime   float64 `json:"Actual Total Time"`
+	ActualRows        float64 `json:"Actual Rows"`
+	ActualLoops       float64 `json:"Actual Loops"`
+
+	Plans []*PlanNode `json:"Plans"`
+}
+
+// Walk calls fn for every node of the plan in depth-first order, skipping the
+// children of nodes for which fn returns false.
+func (p *Plan) Walk(fn func(*PlanNode) bool) {
+	if p.Root != nil {
+		p.Root.walk(fn)
+	}
+}
+
+func (n *PlanNode) walk(fn func(*PlanNode) bool) {
+	if !fn(n) {
+		return
+	}
+	for _, child := range n.Plans {
+		child.walk(fn)
+	}
+}
+
+// Nodes returns every node of the plan in depth-first order.
+func (p *Plan) Nodes() []*PlanNode {
+	var nodes []*PlanNode
+	p.Walk(func(n *PlanNode) bool {
+		nodes = append(nodes, n)
+		return true
+	})
+	return nodes
+}
+
+// Indexes returns the names of the indexes used by the plan.
+func (p *Plan) Indexes() []string {
+	var indexes []string
+	seen := make(map[string]bool)
+	p.Walk(func(n *PlanNode) bool {
+		if n.IndexName != "" && !seen[n.IndexName] {
+			seen[n.IndexName] = true
+			indexes = append(indexes, n.IndexName)
+		}
+		return true
+	})
+	return indexes
+}
+
+// SeqScans returns the sequential scan nodes of the plan.
+func (p *Plan) SeqScans() []*PlanNode {
+	var scans []*PlanNode
+	p.Walk(func(n *PlanNode) bool {
+		if n.NodeType == "Seq Scan" {
+			scans = append(scans, n)
+		}
+		return true
+	})
+	return scans
+}
+
+func (s *store) Explain(ctx context.Context, query Query, args ...interface{}) (*Plan, error) {
+	return pgExplain(ctx, &s.info, s.pool, query, false, args...)
+}
+
+func (s *store) ExplainAnalyze(ctx context.Context, query Query, args ...interface{}) (*Plan, error) {
+	sqlTx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// ANALYZE executes the query, so always roll back its effects.
+	defer sqlTx.Rollback(ctx)
+
+	return pgExplain(ctx, &s.info, sqlTx, query, true, args...)
+}
+
+func pgExplain(ctx context.Context, info *StoreInfo, q queryable, query Query, analyze bool, args ...interface{}) (*Plan, error) {
+	query, err := query.withCursorArgs()
+	if err != nil {
+		return nil, &QueryError{query, err}
+	}
+	query.explain = "EXPLAIN (FORMAT JSON)"
+	if analyze {
+		query.explain = "EXPLAIN (FORMAT JSON, ANALYZE, BUFFERS)"
+	}
+
+	var out []byte
+	err = pgGet(ctx, info, q, &out, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var plans []Plan
+	err = json.Unmarshal(out, &plans)
+	if err != nil {
+		return nil, &QueryError{query, err}
+	}
+	if len(plans) == 0 {
+		return nil, &QueryError{query, errors.New("EXPLAIN returned no plan")}
+	}
+	return &plans[0], nil
+}
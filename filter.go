@@ -0,0 +1,68 @@
+package pge
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Where adds a condition to the query's Filters template parameter, joined to
+// any previous conditions with AND. Placeholders in condition are numbered
+// from $1 relative to its own args, and are renumbered to follow the query's
+// parameters and the args of previous conditions. The args are bound to the
+// query and passed after the arguments given to Execute, Get or Select.
+//
+// Queries reference the conditions as {{.Filters}}, which renders as "true"
+// when no condition has been added:
+//
+//	SELECT * FROM customers WHERE {{.Filters}} ORDER BY id
+func (q Query) Where(condition string, args ...interface{}) Query {
+	condition = renumberPlaceholders(condition, q.paramCount())
+	q.filters = append(q.filters[:len(q.filters):len(q.filters)], condition)
+	q.args = append(q.args[:len(q.args):len(q.args)], args...)
+	return q
+}
+
+// paramCount returns the number of parameters the query expects, including
+// those bound by Where.
+func (q Query) paramCount() int {
+	params := q.queryParams
+	// Insert queries take the values of a row, which WithValues generates
+	// placeholders for when rendering.
+	if q.insertCols > params {
+		params = q.insertCols
+	}
+	for _, sql := range []string{q.prefix, q.suffix} {
+		if n := maxPlaceholder(sql); n > params {
+			params = n
+		}
+	}
+	return params + len(q.args)
+}
+
+func (q Query) filterExpression() string {
+	if len(q.filters) == 0 {
+		return "true"
+	}
+	return "(" + strings.Join(q.filters, ") AND (") + ")"
+}
+
+// arguments returns the arguments to execute the query with: args supplied
+// by the caller followed by the args bound by Where and the cursor.
+func (q Query) arguments(args []interface{}) []interface{} {
+	if len(q.args) == 0 && len(q.cursorArgs) == 0 {
+		return args
+	}
+	all := make([]interface{}, 0, len(args)+len(q.args)+len(q.cursorArgs))
+	all = append(all, args...)
+	all = append(all, q.args...)
+	return append(all, q.cursorArgs...)
+}
+
+func renumberPlaceholders(sql string, offset int) string {
+	if offset == 0 {
+		return sql
+	}
+	return rewritePlaceholders(sql, func(n int) string {
+		return "$" + strconv.Itoa(n+offset)
+	})
+}
@@ -0,0 +1,242 @@
+package pge
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// Identifier is a possibly qualified SQL identifier, such as a table or
+// column name. Each part is double quoted when rendered, so identifiers from
+// untrusted input cannot inject SQL.
+type Identifier []string
+
+func (id Identifier) String() string {
+	parts := make([]string, len(id))
+	for i, part := range id {
+		parts[i] = QuoteIdentifier(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+// Literal is a SQL string constant, single quoted when rendered.
+type Literal string
+
+func (l Literal) String() string {
+	return QuoteLiteral(string(l))
+}
+
+// SQL is a trusted SQL fragment rendered verbatim. It must never be built
+// from untrusted input.
+type SQL string
+
+// QuoteIdentifier double quotes name for use as a SQL identifier.
+func QuoteIdentifier(name string) string {
+	name = strings.ReplaceAll(name, "\x00", "")
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// QuoteLiteral single quotes s for use as a SQL string constant. Strings
+// containing backslashes are written as escape strings so that they are read
+// the same regardless of standard_conforming_strings.
+func QuoteLiteral(s string) string {
+	s = strings.ReplaceAll(s, "\x00", "")
+	s = strings.ReplaceAll(s, "'", "''")
+	if strings.Contains(s, `\`) {
+		return `E'` + strings.ReplaceAll(s, `\`, `\\`) + `'`
+	}
+	return "'" + s + "'"
+}
+
+// funcs are available to every query template:
+//
+//	ident      quotes its arguments as the parts of one identifier
+//	literal    quotes a value as a SQL constant
+//	columns    quotes a list of column names and joins them with commas
+//	join       joins a list of values with a separator, quoting strings
+//	           as identifiers
+//	placeholders generates n comma separated placeholders starting at $start
+var funcs = template.FuncMap{
+	"ident": func(parts ...string) Identifier {
+		return Identifier(parts)
+	},
+	"literal":      literal,
+	"columns":      columns,
+	"join":         join,
+	"placeholders": placeholders,
+}
+
+func literal(v interface{}) (SQL, error) {
+	switch v := v.(type) {
+	case string:
+		return SQL(QuoteLiteral(v)), nil
+	case Literal:
+		return SQL(v.String()), nil
+	case bool:
+		return SQL(strconv.FormatBool(v)), nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return SQL(fmt.Sprint(v)), nil
+	case nil:
+		return "NULL", nil
+	default:
+		return "", fmt.Errorf("cannot quote %T as a literal", v)
+	}
+}
+
+func columns(cols interface{}) (SQL, error) {
+	return join(", ", cols)
+}
+
+func join(sep string, items interface{}) (SQL, error) {
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return "", fmt.Errorf("cannot join %T", items)
+	}
+
+	parts := make([]string, v.Len())
+	for i := range parts {
+		switch item := v.Index(i).Interface().(type) {
+		case string:
+			parts[i] = QuoteIdentifier(item)
+		case Identifier, Literal, SQL:
+			parts[i] = fmt.Sprint(item)
+		default:
+			return "", fmt.Errorf("cannot join %T", item)
+		}
+	}
+	return SQL(strings.Join(parts, sep)), nil
+}
+
+func placeholders(start, n int) (SQL, error) {
+	if start < 1 || n < 1 {
+		return "", fmt.Errorf("invalid placeholders %d, %d", start, n)
+	}
+	params := make([]string, n)
+	for i := range params {
+		params[i] = "$" + strconv.Itoa(start+i)
+	}
+	return SQL(strings.Join(params, ", ")), nil
+}
+
+// maxTemplatePlaceholder returns the highest placeholder generated by calls to
+// the placeholders function with constant arguments under node.
+func maxTemplatePlaceholder(node parse.Node) int {
+	max := 0
+	visit := func(n parse.Node) {
+		if m := maxTemplatePlaceholder(n); m > max {
+			max = m
+		}
+	}
+
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return 0
+		}
+		for _, n := range node.Nodes {
+			visit(n)
+		}
+	case *parse.ActionNode:
+		visit(node.Pipe)
+	case *parse.IfNode:
+		visit(node.Pipe)
+		visit(node.List)
+		visit(node.ElseList)
+	case *parse.RangeNode:
+		visit(node.Pipe)
+		visit(node.List)
+		visit(node.ElseList)
+	case *parse.WithNode:
+		visit(node.Pipe)
+		visit(node.List)
+		visit(node.ElseList)
+	case *parse.PipeNode:
+		if node == nil {
+			return 0
+		}
+		for _, cmd := range node.Cmds {
+			visit(cmd)
+		}
+	case *parse.CommandNode:
+		for _, arg := range node.Args {
+			visit(arg)
+		}
+		if len(node.Args) != 3 {
+			break
+		}
+		fn, ok := node.Args[0].(*parse.IdentifierNode)
+		start, ok1 := node.Args[1].(*parse.NumberNode)
+		n, ok2 := node.Args[2].(*parse.NumberNode)
+		if ok && ok1 && ok2 && fn.Ident == "placeholders" && start.IsInt && n.IsInt {
+			if last := int(start.Int64 + n.Int64 - 1); last > max {
+				max = last
+			}
+		}
+	}
+	return max
+}
+
+var (
+	identifierType = reflect.TypeOf(Identifier(nil))
+	literalType    = reflect.TypeOf(Literal(""))
+	sqlType        = reflect.TypeOf(SQL(""))
+	byteType       = reflect.TypeOf(byte(0))
+
+	stringerType  = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	formatterType = reflect.TypeOf((*fmt.Formatter)(nil)).Elem()
+	errorType     = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// checkTemplateParameter rejects template parameters that are not known to
+// render safely, since they are rendered into the query verbatim. Identifier,
+// Literal and SQL are accepted along with booleans, numbers and slices of
+// them.
+func checkTemplateParameter(param string, value interface{}) error {
+	t := reflect.TypeOf(value)
+	if t == nil || !isTemplateType(t) && !isTemplateSlice(t) {
+		return fmt.Errorf("template parameter %q has type %T, use pge.Identifier, pge.Literal or pge.SQL to declare how it is quoted", param, value)
+	}
+	return nil
+}
+
+// isTemplateType reports whether values of t render safely in a template.
+func isTemplateType(t reflect.Type) bool {
+	switch t {
+	case identifierType, literalType, sqlType:
+		return true
+	}
+	if printsCustom(t) {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// isTemplateSlice reports whether t is a slice or array of types that render
+// safely. Byte slices are excluded, since they usually hold text.
+func isTemplateSlice(t reflect.Type) bool {
+	if t.Kind() != reflect.Slice && t.Kind() != reflect.Array || printsCustom(t) {
+		return false
+	}
+	return t.Elem() != byteType && isTemplateType(t.Elem())
+}
+
+// printsCustom reports whether t or a pointer to it controls how it is
+// printed, which text/template honors when rendering it.
+func printsCustom(t reflect.Type) bool {
+	for _, t := range []reflect.Type{t, reflect.PtrTo(t)} {
+		if t.Implements(stringerType) || t.Implements(formatterType) || t.Implements(errorType) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package pge
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type testString string
+
+type testSize int
+
+type testLevel int
+
+func (l testLevel) String() string { return "1; DROP TABLE t" }
+
+type testPtrLevel int
+
+func (l *testPtrLevel) String() string { return "1; DROP TABLE t" }
+
+func TestCheckTemplateParameter(t *testing.T) {
+	s := "t"
+	for _, tc := range []struct {
+		name  string
+		value interface{}
+		ok    bool
+	}{
+		{"identifier", Identifier{"public", "t"}, true},
+		{"literal", Literal("a"), true},
+		{"sql", SQL("true"), true},
+		{"bool", true, true},
+		{"int", 1, true},
+		{"uint8", uint8(1), true},
+		{"float", 1.5, true},
+		{"named int", testSize(1), true},
+		{"duration", time.Second, false},
+		{"pointer stringer", testPtrLevel(1), false},
+		{"identifiers", []Identifier{{"a"}, {"b"}}, true},
+		{"sqls", []SQL{"a", "b"}, true},
+		{"ints", []int{1, 2}, true},
+		{"int array", [2]int{1, 2}, true},
+		{"string", "t", false},
+		{"string pointer", &s, false},
+		{"strings", []string{"t"}, false},
+		{"named string", testString("1; DROP TABLE t"), false},
+		{"named strings", []testString{"t"}, false},
+		{"stringer", testLevel(1), false},
+		{"stringers", []testLevel{1}, false},
+		{"pointer stringers", []testPtrLevel{1}, false},
+		{"bytes", []byte("t"), false},
+		{"error", errors.New("t"), false},
+		{"map", map[string]int{}, false},
+		{"struct", struct{}{}, false},
+		{"nil", nil, false},
+		{"nested slices", [][]int{{1}}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkTemplateParameter("P", tc.value)
+			if tc.ok && err != nil {
+				t.Errorf("checkTemplateParameter(%#v) = %v, want nil", tc.value, err)
+			}
+			if !tc.ok && err == nil {
+				t.Errorf("checkTemplateParameter(%#v) accepted", tc.value)
+			}
+		})
+	}
+}
+
+func TestWithTemplateParameterRejects(t *testing.T) {
+	q := newQuery("test template parameter", "SELECT {{.X}}").
+		WithTemplateParameter("X", testString("1; DROP TABLE t"))
+	if _, err := q.Render(); err == nil {
+		t.Error("Render() accepted a named string type")
+	}
+}
@@ -0,0 +1,311 @@
+// Package gen generates typed Go wrappers for pge queries by describing them
+// against a live postgres database.
+package gen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/format"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hinshun/pge"
+	pgx "github.com/jackc/pgx/v4"
+)
+
+// Config configures the generated Go file.
+type Config struct {
+	// Package is the name of the generated package.
+	Package string
+
+	// Queries are the queries to generate wrappers for.
+	Queries []pge.Query
+
+	// QueryExpr returns the Go expression that refers to a query from the
+	// generated package, such as "sql.SelectCustomers". Defaults to indexing
+	// the map returned by LoadQueries as `queries[name]`, which is what
+	// EmbedPattern sets up.
+	QueryExpr func(pge.Query) string
+
+	// Imports are extra import paths needed by QueryExpr.
+	Imports []string
+
+	// EmbedPattern, when set, embeds the .sql files matching it into the
+	// generated package and loads them into a package variable named
+	// queries.
+	EmbedPattern string
+}
+
+// Generate describes each query with conn and returns a gofmt'd Go file with
+// a function per query taking a pge.Conn, the query's parameters with the
+// Go types postgres inferred for them, and returning its rows.
+//
+// Queries with a cursor column return a page of rows for a *pge.Paginator,
+// insert queries and queries without a cursor starting with SELECT, WITH or
+// VALUES return rows, and queries returning no columns return only an error.
+// Insert queries returning columns return a single row, unless they insert
+// arrays of rows with pge.WithUnnest.
+func Generate(ctx context.Context, conn *pgx.Conn, cfg Config) ([]byte, error) {
+	if cfg.QueryExpr == nil {
+		cfg.QueryExpr = func(q pge.Query) string {
+			return "queries[" + strconv.Quote(q.Name) + "]"
+		}
+	}
+
+	g := &generator{
+		conn:    conn,
+		imports: map[string]bool{"context": true, "github.com/hinshun/pge": true},
+	}
+	for _, path := range cfg.Imports {
+		g.imports[path] = true
+	}
+
+	queries := append([]pge.Query(nil), cfg.Queries...)
+	sort.Slice(queries, func(i, j int) bool {
+		return queries[i].Name < queries[j].Name
+	})
+
+	for _, q := range queries {
+		if err := g.query(ctx, q, cfg.QueryExpr(q)); err != nil {
+			return nil, fmt.Errorf("%s: %w", q.Name, err)
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by pge generate. DO NOT EDIT.\n\npackage %s\n\n", cfg.Package)
+	if cfg.EmbedPattern != "" {
+		g.imports["embed"] = true
+	}
+
+	paths := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	out.WriteString("import (\n")
+	for _, path := range paths {
+		fmt.Fprintf(&out, "\t%q\n", path)
+	}
+	out.WriteString(")\n\n")
+
+	if cfg.EmbedPattern != "" {
+		fmt.Fprintf(&out, "//go:embed %s\nvar queryFiles embed.FS\n\n", cfg.EmbedPattern)
+		out.WriteString("var queries = mustLoadQueries()\n\n")
+		out.WriteString("func mustLoadQueries() map[string]pge.Query {\n")
+		fmt.Fprintf(&out, "\tqueries, err := pge.LoadQueries(queryFiles, %q)\n", cfg.EmbedPattern)
+		out.WriteString("\tif err != nil {\n\t\tpanic(err)\n\t}\n\treturn queries\n}\n\n")
+	}
+	out.Write(g.body.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated code: %w\n%s", err, out.Bytes())
+	}
+	return src, nil
+}
+
+type generator struct {
+	conn    *pgx.Conn
+	imports map[string]bool
+	body    bytes.Buffer
+}
+
+type column struct {
+	name     string
+	field    string
+	typ      string
+	nullable bool
+}
+
+type param struct {
+	name string
+	typ  string
+}
+
+func (g *generator) query(ctx context.Context, q pge.Query, expr string) error {
+	paginated := q.CursorColumn() != ""
+	described := q
+	if paginated {
+		var err error
+		described, err = q.WithPaginator(&pge.Paginator{First: 1})
+		if err != nil {
+			return err
+		}
+	}
+
+	sql, err := described.Render()
+	if err != nil {
+		return err
+	}
+
+	// The unnamed statement describes the query without leaving a prepared
+	// statement behind.
+	sd, err := g.conn.Prepare(ctx, "", sql)
+	if err != nil {
+		return err
+	}
+
+	params, err := g.params(q, sql, sd.ParamOIDs)
+	if err != nil {
+		return err
+	}
+
+	var cols []column
+	seen := make(map[string]int)
+	for _, f := range sd.Fields {
+		nullable, err := g.nullable(ctx, f.TableOID, f.TableAttributeNumber)
+		if err != nil {
+			return err
+		}
+		typ := goType(g.typeName(f.DataTypeOID), nullable)
+		g.use(typ)
+
+		name := string(f.Name)
+		field := exportedName(name)
+		if n := seen[field]; n > 0 {
+			field += strconv.Itoa(n + 1)
+		}
+		seen[exportedName(name)]++
+		cols = append(cols, column{name: name, field: field, typ: typ, nullable: nullable})
+	}
+
+	fn := exportedName(q.Name)
+	// Paginated rows are always structs, since cursors are read from their
+	// ToCursor method or db tagged fields.
+	rowType := ""
+	switch {
+	case len(cols) == 0:
+	case len(cols) == 1 && !paginated:
+		rowType = cols[0].typ
+	default:
+		rowType = fn + "Row"
+		fmt.Fprintf(&g.body, "type %s struct {\n", rowType)
+		for _, col := range cols {
+			fmt.Fprintf(&g.body, "\t%s %s `db:%q`\n", col.field, col.typ, col.name)
+		}
+		g.body.WriteString("}\n\n")
+	}
+
+	// Rows paginated by several columns have their cursors read from the
+	// db tagged fields instead.
+	if paginated && len(cols) > 0 && len(q.CursorColumns()) == 1 {
+		g.cursorMethod(rowType, q.CursorColumn(), cols)
+	}
+
+	var sig, args []string
+	sig = append(sig, "ctx context.Context", "c pge.Conn")
+	if paginated {
+		sig = append(sig, "p *pge.Paginator")
+	}
+	for _, p := range params {
+		sig = append(sig, p.name+" "+p.typ)
+		args = append(args, p.name)
+	}
+	callArgs := ""
+	if len(args) > 0 {
+		callArgs = ", " + strings.Join(args, ", ")
+	}
+
+	switch {
+	case len(cols) == 0:
+		fmt.Fprintf(&g.body, "func %s(%s) error {\n", fn, strings.Join(sig, ", "))
+		fmt.Fprintf(&g.body, "\t_, err := c.Execute(ctx, %s%s)\n\treturn err\n}\n\n", expr, callArgs)
+
+	case paginated:
+		fmt.Fprintf(&g.body, "func %s(%s) (rows []%s, page pge.PageInfo, err error) {\n", fn, strings.Join(sig, ", "), rowType)
+		fmt.Fprintf(&g.body, "\tq, err := %s.WithPaginator(p)\n\tif err != nil {\n\t\treturn nil, page, err\n\t}\n", expr)
+		fmt.Fprintf(&g.body, "\tpage, err = c.PaginatedSelect(ctx, &rows, q%s)\n\treturn\n}\n\n", callArgs)
+
+	case q.InsertColumns() > 0 && len(q.UnnestTypes()) == 0:
+		fmt.Fprintf(&g.body, "func %s(%s) (row %s, err error) {\n", fn, strings.Join(sig, ", "), rowType)
+		fmt.Fprintf(&g.body, "\terr = c.Get(ctx, &row, %s%s)\n\treturn\n}\n\n", expr, callArgs)
+
+	default:
+		fmt.Fprintf(&g.body, "func %s(%s) (rows []%s, err error) {\n", fn, strings.Join(sig, ", "), rowType)
+		fmt.Fprintf(&g.body, "\terr = c.Select(ctx, &rows, %s%s)\n\treturn\n}\n\n", expr, callArgs)
+	}
+	return nil
+}
+
+// cursorMethod generates a ToCursor method for paginated rows when the cursor
+// column is an integer or string, which pgx can convert back from the cursor
+// string.
+func (g *generator) cursorMethod(rowType, cursorCol string, cols []column) {
+	if i := strings.LastIndexByte(cursorCol, '.'); i >= 0 {
+		cursorCol = cursorCol[i+1:]
+	}
+	for _, col := range cols {
+		if col.name != cursorCol || col.nullable {
+			continue
+		}
+		switch col.typ {
+		case "string":
+			fmt.Fprintf(&g.body, "func (r %s) ToCursor() string {\n\treturn r.%s\n}\n\n", rowType, col.field)
+		case "int16", "int32", "int64":
+			g.imports["strconv"] = true
+			fmt.Fprintf(&g.body, "func (r %s) ToCursor() string {\n\treturn strconv.FormatInt(int64(r.%s), 10)\n}\n\n", rowType, col.field)
+		}
+		return
+	}
+}
+
+// comparisonParam matches a placeholder compared against a column, which
+// gives the parameter its name.
+var comparisonParam = regexp.MustCompile(`(?i)([a-z_][a-z0-9_]*)"?\s*(?:=|<>|!=|<=|>=|<|>|\bLIKE\b|\bILIKE\b|\bIN\s*\()\s*\$(\d+)\b`)
+
+func (g *generator) params(q pge.Query, sql string, oids []uint32) ([]param, error) {
+	names := make(map[int]string)
+	for _, match := range comparisonParam.FindAllStringSubmatch(sql, -1) {
+		n, _ := strconv.Atoi(match[2])
+		if _, ok := names[n]; !ok {
+			names[n] = unexportedName(match[1])
+		}
+	}
+	if cols := q.InsertColumnNames(); len(cols) == len(oids) {
+		for i, col := range cols {
+			names[i+1] = unexportedName(col)
+		}
+	}
+
+	used := make(map[string]bool)
+	params := make([]param, len(oids))
+	for i, oid := range oids {
+		name, ok := names[i+1]
+		if !ok || used[name] {
+			name = "arg" + strconv.Itoa(i+1)
+		}
+		used[name] = true
+
+		typ := goType(g.typeName(oid), false)
+		g.use(typ)
+		params[i] = param{name: name, typ: typ}
+	}
+	return params, nil
+}
+
+func (g *generator) typeName(oid uint32) string {
+	if dt, ok := g.conn.ConnInfo().DataTypeForOID(oid); ok {
+		return dt.Name
+	}
+	return ""
+}
+
+// nullable reports whether a result column may be null, which is only known
+// for columns read directly from a table with a NOT NULL constraint.
+func (g *generator) nullable(ctx context.Context, table uint32, attr uint16) (bool, error) {
+	if table == 0 || attr == 0 {
+		return true, nil
+	}
+	var notNull bool
+	err := g.conn.QueryRow(ctx, "SELECT attnotnull FROM pg_attribute WHERE attrelid = $1 AND attnum = $2", table, attr).Scan(&notNull)
+	return !notNull, err
+}
+
+func (g *generator) use(typ string) {
+	if path := importFor(typ); path != "" {
+		g.imports[path] = true
+	}
+}
@@ -0,0 +1,170 @@
+package gen
+
+import "strings"
+
+// goTypes maps postgres type names to the Go types pgx scans them into.
+var goTypes = map[string]string{
+	"bool":        "bool",
+	"bytea":       "[]byte",
+	"char":        "string",
+	"name":        "string",
+	"int8":        "int64",
+	"int2":        "int16",
+	"int4":        "int32",
+	"text":        "string",
+	"json":        "[]byte",
+	"jsonb":       "[]byte",
+	"xml":         "string",
+	"float4":      "float32",
+	"float8":      "float64",
+	"bpchar":      "string",
+	"varchar":     "string",
+	"date":        "time.Time",
+	"time":        "pgtype.Time",
+	"timestamp":   "time.Time",
+	"timestamptz": "time.Time",
+	"interval":    "time.Duration",
+	"numeric":     "pgtype.Numeric",
+	"uuid":        "string",
+	"inet":        "net.IPNet",
+	"cidr":        "net.IPNet",
+	"oid":         "uint32",
+}
+
+// typeImports maps qualified Go types to the packages they need.
+var typeImports = map[string]string{
+	"time":   "time",
+	"pgtype": "github.com/jackc/pgtype",
+	"net":    "net",
+}
+
+// goType returns the Go type for the postgres type name. Array type names
+// are prefixed with an underscore in pg_type. Nullable values are scanned
+// into pointers.
+func goType(pgType string, nullable bool) string {
+	if strings.HasPrefix(pgType, "_") {
+		if elem, ok := goTypes[pgType[1:]]; ok {
+			return "[]" + elem
+		}
+		return "interface{}"
+	}
+
+	typ, ok := goTypes[pgType]
+	if !ok {
+		return "interface{}"
+	}
+	if nullable {
+		return "*" + typ
+	}
+	return typ
+}
+
+// importFor returns the import path needed to use typ, if any.
+func importFor(typ string) string {
+	typ = strings.TrimLeft(typ, "*[]")
+	if i := strings.IndexByte(typ, '.'); i > 0 {
+		return typeImports[typ[:i]]
+	}
+	return ""
+}
+
+// initialisms are written in upper case in Go identifiers.
+var initialisms = map[string]bool{
+	"api":  true,
+	"id":   true,
+	"ip":   true,
+	"json": true,
+	"sql":  true,
+	"url":  true,
+	"uuid": true,
+	"http": true,
+}
+
+// exportedName converts a query or column name such as "select customer by
+// id" or "customer_id" into an exported Go identifier.
+func exportedName(name string) string {
+	var b strings.Builder
+	for _, word := range splitWords(name) {
+		if initialisms[strings.ToLower(word)] {
+			b.WriteString(strings.ToUpper(word))
+			continue
+		}
+		b.WriteString(strings.ToUpper(word[:1]))
+		b.WriteString(word[1:])
+	}
+	if b.Len() == 0 || (b.String()[0] >= '0' && b.String()[0] <= '9') {
+		return "X" + b.String()
+	}
+	return b.String()
+}
+
+// unexportedName converts a column name into an unexported Go identifier.
+func unexportedName(name string) string {
+	words := splitWords(name)
+	if len(words) == 0 {
+		return "arg"
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.ToLower(words[0]))
+	for _, word := range words[1:] {
+		if initialisms[strings.ToLower(word)] {
+			b.WriteString(strings.ToUpper(word))
+			continue
+		}
+		b.WriteString(strings.ToUpper(word[:1]))
+		b.WriteString(word[1:])
+	}
+	if keywords[b.String()] {
+		return b.String() + "_"
+	}
+	return b.String()
+}
+
+var keywords = map[string]bool{
+	"break": true, "case": true, "chan": true, "const": true, "continue": true,
+	"default": true, "defer": true, "else": true, "fallthrough": true,
+	"for": true, "func": true, "go": true, "goto": true, "if": true,
+	"import": true, "interface": true, "map": true, "package": true,
+	"range": true, "return": true, "select": true, "struct": true,
+	"switch": true, "type": true, "var": true,
+	// Names used by the generated functions themselves.
+	"ctx": true, "c": true, "q": true, "p": true, "err": true,
+	"rows": true, "row": true, "page": true,
+}
+
+// splitWords splits name on non-alphanumeric characters and lower to upper
+// case transitions.
+func splitWords(name string) []string {
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = nil
+		}
+	}
+
+	runes := []rune(name)
+	for i, r := range runes {
+		switch {
+		case !isAlnum(r):
+			flush()
+		case i > 0 && isUpper(r) && isLower(runes[i-1]):
+			flush()
+			word = append(word, r)
+		default:
+			word = append(word, r)
+		}
+	}
+	flush()
+	return words
+}
+
+func isAlnum(r rune) bool {
+	return isUpper(r) || isLower(r) || (r >= '0' && r <= '9')
+}
+
+func isUpper(r rune) bool { return r >= 'A' && r <= 'Z' }
+
+func isLower(r rune) bool { return r >= 'a' && r <= 'z' }
@@ -3,7 +3,7 @@ module github.com/hinshun/pge
 go 1.16
 
 require (
-	github.com/georgysavva/scany v0.2.9 // indirect
-	github.com/jackc/pgconn v1.10.1 // indirect
-	github.com/jackc/pgx/v4 v4.14.1 // indirect
+	github.com/georgysavva/scany v0.2.9
+	github.com/jackc/pgconn v1.10.1
+	github.com/jackc/pgx/v4 v4.14.1
 )
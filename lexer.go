@@ -0,0 +1,248 @@
+package pge
+
+import (
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenText tokenKind = iota
+	tokenSpace
+	tokenComment
+	tokenString
+	tokenIdentifier
+	tokenPlaceholder
+	tokenTemplate
+)
+
+// token is a span of SQL text. Text tokens are keywords, unquoted
+// identifiers, numbers and operators; everything else is quoted or otherwise
+// opaque to the code that rewrites queries.
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// lexSQL splits sql into tokens, understanding enough of the postgres lexical
+// structure to tell comments, string constants (including escape strings and
+// dollar quoting), quoted identifiers and $n placeholders apart. Template
+// actions are kept whole so that quotes inside them are not mistaken for SQL.
+func lexSQL(sql string) []token {
+	var tokens []token
+	emit := func(kind tokenKind, end int) {
+		tokens = append(tokens, token{kind: kind, text: sql[:end]})
+		sql = sql[end:]
+	}
+
+	for len(sql) > 0 {
+		c := sql[0]
+		switch {
+		case isSpace(c):
+			end := 1
+			for end < len(sql) && isSpace(sql[end]) {
+				end++
+			}
+			emit(tokenSpace, end)
+
+		case strings.HasPrefix(sql, "--"):
+			end := strings.IndexByte(sql, '\n')
+			if end < 0 {
+				end = len(sql)
+			}
+			emit(tokenComment, end)
+
+		case strings.HasPrefix(sql, "/*"):
+			emit(tokenComment, blockCommentEnd(sql))
+
+		case strings.HasPrefix(sql, "{{"):
+			end := strings.Index(sql, "}}")
+			if end < 0 {
+				end = len(sql)
+			} else {
+				end += 2
+			}
+			emit(tokenTemplate, end)
+
+		case c == '\'':
+			emit(tokenString, quotedEnd(sql, '\'', false))
+
+		case c == '"':
+			emit(tokenIdentifier, quotedEnd(sql, '"', false))
+
+		case (c == 'E' || c == 'e') && len(sql) > 1 && sql[1] == '\'':
+			emit(tokenString, 1+quotedEnd(sql[1:], '\'', true))
+
+		case c == '$':
+			if end := placeholderEnd(sql); end > 0 {
+				emit(tokenPlaceholder, end)
+			} else if end := dollarQuoteEnd(sql); end > 0 {
+				emit(tokenString, end)
+			} else {
+				emit(tokenText, 1)
+			}
+
+		case isIdentStart(c):
+			end := 1
+			for end < len(sql) && isIdentPart(sql[end]) {
+				end++
+			}
+			emit(tokenText, end)
+
+		default:
+			emit(tokenText, 1)
+		}
+	}
+	return tokens
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+// isIdentPart reports whether c may continue an unquoted identifier. Postgres
+// allows dollar signs within identifiers, so `a$1` is not a placeholder.
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9') || c == '$'
+}
+
+// blockCommentEnd returns the end of the block comment sql starts with.
+// Postgres block comments nest.
+func blockCommentEnd(sql string) int {
+	depth := 0
+	for i := 0; i < len(sql)-1; i++ {
+		switch {
+		case sql[i] == '/' && sql[i+1] == '*':
+			depth++
+			i++
+		case sql[i] == '*' && sql[i+1] == '/':
+			depth--
+			i++
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(sql)
+}
+
+// quotedEnd returns the end of the quoted span sql starts with. A doubled
+// quote is an escaped quote, as is a backslash-escaped one in escape strings.
+func quotedEnd(sql string, quote byte, backslashEscapes bool) int {
+	for i := 1; i < len(sql); i++ {
+		switch {
+		case backslashEscapes && sql[i] == '\\':
+			i++
+		case sql[i] == quote:
+			if i+1 < len(sql) && sql[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(sql)
+}
+
+// placeholderEnd returns the end of the $n placeholder sql starts with, or 0.
+func placeholderEnd(sql string) int {
+	end := 1
+	for end < len(sql) && sql[end] >= '0' && sql[end] <= '9' {
+		end++
+	}
+	if end == 1 {
+		return 0
+	}
+	return end
+}
+
+// dollarQuoteEnd returns the end of the $tag$...$tag$ string sql starts with,
+// or 0 if sql does not start with a dollar quote.
+func dollarQuoteEnd(sql string) int {
+	end := 1
+	for end < len(sql) && sql[end] != '$' {
+		if !isIdentStart(sql[end]) && !(end > 1 && sql[end] >= '0' && sql[end] <= '9') {
+			return 0
+		}
+		end++
+	}
+	if end == len(sql) {
+		return 0
+	}
+
+	tag := sql[:end+1]
+	close := strings.Index(sql[len(tag):], tag)
+	if close < 0 {
+		return len(sql)
+	}
+	return len(tag) + close + len(tag)
+}
+
+// stripComments removes comments from sql, leaving a space in their place so
+// that the tokens on either side are not joined together.
+func stripComments(sql string) string {
+	var b strings.Builder
+	for _, tok := range lexSQL(sql) {
+		if tok.kind == tokenComment {
+			b.WriteString(" ")
+			continue
+		}
+		b.WriteString(tok.text)
+	}
+	return b.String()
+}
+
+// collapseSpace trims sql and collapses whitespace between tokens into single
+// spaces, leaving string constants untouched.
+func collapseSpace(sql string) string {
+	var b strings.Builder
+	b.Grow(len(sql))
+	for _, tok := range lexSQL(strings.TrimSpace(sql)) {
+		if tok.kind == tokenSpace {
+			b.WriteString(" ")
+			continue
+		}
+		b.WriteString(tok.text)
+	}
+	return b.String()
+}
+
+// maxPlaceholder returns the highest $n placeholder in sql.
+func maxPlaceholder(sql string) int {
+	max := 0
+	for _, tok := range lexSQL(sql) {
+		if tok.kind != tokenPlaceholder {
+			continue
+		}
+		n, err := strconv.Atoi(tok.text[1:])
+		if err == nil && n > max {
+			max = n
+		}
+	}
+	return max
+}
+
+// rewritePlaceholders replaces each $n placeholder in sql with the result of
+// fn(n).
+func rewritePlaceholders(sql string, fn func(n int) string) string {
+	var b strings.Builder
+	b.Grow(len(sql))
+	for _, tok := range lexSQL(sql) {
+		if tok.kind != tokenPlaceholder {
+			b.WriteString(tok.text)
+			continue
+		}
+		n, err := strconv.Atoi(tok.text[1:])
+		if err != nil {
+			b.WriteString(tok.text)
+			continue
+		}
+		b.WriteString(fn(n))
+	}
+	return b.String()
+}
@@ -0,0 +1,102 @@
+package pge
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestStripComments(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		sql  string
+		want string
+	}{
+		{"line comment", "SELECT 1 -- one\nFROM t", "SELECT 1  \nFROM t"},
+		{"trailing line comment", "SELECT 1 -- one", "SELECT 1  "},
+		{"block comment", "SELECT /* a */ 1", "SELECT   1"},
+		{"nested block comment", "SELECT /* a /* b */ c */ 1", "SELECT   1"},
+		{"unterminated block comment", "SELECT 1 /* a", "SELECT 1  "},
+		{"comment joining tokens", "SELECT/**/1", "SELECT 1"},
+		{"dashes in string", "SELECT '--not a comment'", "SELECT '--not a comment'"},
+		{"block in string", "SELECT '/* no */'", "SELECT '/* no */'"},
+		{"doubled quote", "SELECT 'it''s -- here'", "SELECT 'it''s -- here'"},
+		{"escape string", `SELECT E'\'' -- c`, `SELECT E'\''  `},
+		{"escape string backslash", `SELECT E'\\' -- c`, `SELECT E'\\'  `},
+		{"dollar quote", "SELECT $$ -- no $$ -- yes", "SELECT $$ -- no $$  "},
+		{"tagged dollar quote", "SELECT $x$ $$ -- $x$", "SELECT $x$ $$ -- $x$"},
+		{"quoted identifier", `SELECT "a--b" FROM t`, `SELECT "a--b" FROM t`},
+		{"template action", "SELECT {{ \"--\" }} -- c", "SELECT {{ \"--\" }}  "},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := stripComments(tc.sql); got != tc.want {
+				t.Errorf("stripComments(%q) = %q, want %q", tc.sql, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCollapseSpace(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		sql  string
+		want string
+	}{
+		{"trims", "\n\tSELECT 1\n", "SELECT 1"},
+		{"collapses", "SELECT\n\t*\n  FROM   t", "SELECT * FROM t"},
+		{"keeps string", "SELECT 'a   b'\n\nFROM t", "SELECT 'a   b' FROM t"},
+		{"keeps dollar quote", "SELECT $$a\n\nb$$", "SELECT $$a\n\nb$$"},
+		{"keeps identifier", `SELECT "a  b"`, `SELECT "a  b"`},
+		{"empty", "  \n ", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := collapseSpace(tc.sql); got != tc.want {
+				t.Errorf("collapseSpace(%q) = %q, want %q", tc.sql, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRewritePlaceholders(t *testing.T) {
+	shift := func(n int) string {
+		return "$" + strconv.Itoa(n+10)
+	}
+
+	for _, tc := range []struct {
+		name string
+		sql  string
+		want string
+	}{
+		{"placeholders", "a = $1 AND b = $12", "a = $11 AND b = $22"},
+		{"adjacent", "($1,$2)", "($11,$12)"},
+		{"cast", "$1::int", "$11::int"},
+		{"identifier with dollar", "a$1 = $1", "a$1 = $11"},
+		{"string", "'$1' = $1", "'$1' = $11"},
+		{"escape string", `E'\'$1' = $1`, `E'\'$1' = $11`},
+		{"dollar quote", "$$ $1 $$ = $1", "$$ $1 $$ = $11"},
+		{"tagged dollar quote", "$a$ $1 $a$ = $1", "$a$ $1 $a$ = $11"},
+		{"comment", "$1 -- $2\n", "$11 -- $2\n"},
+		{"nested comment", "/* /* $1 */ $2 */ $3", "/* /* $1 */ $2 */ $13"},
+		{"quoted identifier", `"$1" = $1`, `"$1" = $11`},
+		{"lone dollar", "$ $1", "$ $11"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := rewritePlaceholders(tc.sql, shift); got != tc.want {
+				t.Errorf("rewritePlaceholders(%q) = %q, want %q", tc.sql, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMaxPlaceholder(t *testing.T) {
+	for sql, want := range map[string]int{
+		"SELECT 1":                  0,
+		"a = $2 AND b = $10":        10,
+		"'$9' = $1":                 1,
+		"a$3 = $1":                  1,
+		"$q$ $5 $q$ /* $6 */ -- $7": 0,
+	} {
+		if got := maxPlaceholder(sql); got != want {
+			t.Errorf("maxPlaceholder(%q) = %d, want %d", sql, got, want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package pge
+
+import (
+	"errors"
+
+	"github.com/jackc/pgconn"
+)
+
+// lockNotAvailable is the SQLSTATE of NOWAIT lock failures.
+const lockNotAvailable = "55P03"
+
+// LockStrength is the row-level lock taken by a SELECT query.
+type LockStrength string
+
+const (
+	ForUpdate      LockStrength = "FOR UPDATE"
+	ForNoKeyUpdate LockStrength = "FOR NO KEY UPDATE"
+	ForShare       LockStrength = "FOR SHARE"
+	ForKeyShare    LockStrength = "FOR KEY SHARE"
+)
+
+// LockWait decides what a locking query does when rows are already locked.
+type LockWait string
+
+const (
+	// Wait blocks until the rows are unlocked.
+	Wait LockWait = ""
+
+	// NoWait fails with ErrLockNotAvailable.
+	NoWait LockWait = "NOWAIT"
+
+	// SkipLocked leaves locked rows out of the results.
+	SkipLocked LockWait = "SKIP LOCKED"
+)
+
+// WithLocking locks the rows returned by a SELECT query. The locking clause
+// is added after the query and its suffix, but inside the outer SELECT that
+// WithPaginator wraps queries in when paginating backwards. Queries combined
+// with others by Union or UnionAll cannot be locked, as postgres does not
+// allow it.
+func WithLocking(strength LockStrength, wait LockWait) QueryOption {
+	return func(q *Query) {
+		q.lock = lockClause(strength, wait)
+	}
+}
+
+// WithLocking returns a copy of the query that locks the rows it returns, as
+// the WithLocking QueryOption does.
+func (q Query) WithLocking(strength LockStrength, wait LockWait) Query {
+	q.lock = lockClause(strength, wait)
+	return q
+}
+
+func lockClause(strength LockStrength, wait LockWait) string {
+	if wait == Wait {
+		return string(strength)
+	}
+	return string(strength) + " " + string(wait)
+}
+
+// classifyLockError reports NOWAIT lock failures as ErrLockNotAvailable.
+func classifyLockError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == lockNotAvailable {
+		return wrapSentinel(ErrLockNotAvailable, ErrLockNotAvailable.Error(), err)
+	}
+	return err
+}
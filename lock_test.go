@@ -0,0 +1,32 @@
+package pge
+
+import "testing"
+
+func TestWithLocking(t *testing.T) {
+	q := newQuery("test lock customer", "SELECT * FROM customers WHERE id = $1;",
+		WithLocking(ForUpdate, NoWait))
+
+	got, err := q.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "SELECT * FROM customers WHERE id = $1 FOR UPDATE NOWAIT"; got != want {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+
+	got, err = q.WithLocking(ForShare, SkipLocked).Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "SELECT * FROM customers WHERE id = $1 FOR SHARE SKIP LOCKED"; got != want {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+
+	other := newQuery("test select other customers", "SELECT * FROM customers WHERE id = $1;")
+	if _, err := q.Union(other, 2).Render(); err == nil {
+		t.Error("Render() locked a union")
+	}
+	if _, err := other.Union(other, 2).WithLocking(ForUpdate, Wait).Render(); err == nil {
+		t.Error("Render() locked a union")
+	}
+}
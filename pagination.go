@@ -3,10 +3,12 @@ package pge
 import (
 	"errors"
 	"fmt"
+	"math"
 	"net/url"
 	"reflect"
 	"regexp"
 	"strconv"
+	"strings"
 )
 
 // Paginator provides pagination parameters for a select query.
@@ -17,6 +19,12 @@ type Paginator struct {
 	Last int64
 
 	Cursors
+
+	// EdgeCursors makes PaginatedSelect return the cursor of every row.
+	EdgeCursors bool
+
+	// Count makes PaginatedSelect also count the rows of every page.
+	Count CountMode
 }
 
 // QueryParams returns query parameters which encode the pagination settings and
@@ -39,6 +47,108 @@ func (p Paginator) QueryParams() url.Values {
 	return values
 }
 
+// PageLimits bounds the page sizes accepted by ParsePaginator.
+type PageLimits struct {
+	// DefaultSize is the page size when neither first nor last is given.
+	// Defaults to 20.
+	DefaultSize int64
+
+	// MaxSize is the largest page size returned, with larger values of first
+	// or last reduced to it. Zero means page sizes are not limited.
+	MaxSize int64
+}
+
+const defaultPageSize = 20
+
+// maxPageSize bounds page sizes even when PageLimits.MaxSize is unset, so
+// that the extra row fetched to detect another page cannot overflow the
+// LIMIT.
+const maxPageSize = math.MaxInt32
+
+// FieldError describes an invalid pagination query parameter.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// PaginatorError is returned by ParsePaginator when query parameters are
+// invalid, with an error for each invalid parameter.
+type PaginatorError struct {
+	Fields []FieldError
+}
+
+func (e *PaginatorError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		msgs[i] = field.Error()
+	}
+	return "invalid pagination: " + strings.Join(msgs, "; ")
+}
+
+// ParsePaginator returns the Paginator encoded by query parameters such as
+// those produced by QueryParams. first and last, like after and before, are
+// mutually exclusive, and page sizes must be positive. If neither first nor
+// last is given, the first limits.DefaultSize rows are selected. Any
+// parameters that are invalid are reported together in a *PaginatorError.
+func ParsePaginator(values url.Values, limits PageLimits) (*Paginator, error) {
+	var p Paginator
+	var fieldErrs []FieldError
+
+	parseSize := func(field string) int64 {
+		value := values.Get(field)
+		if value == "" {
+			return 0
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			fieldErrs = append(fieldErrs, FieldError{field, "must be an integer"})
+			return 0
+		}
+		if n <= 0 {
+			fieldErrs = append(fieldErrs, FieldError{field, "must be positive"})
+			return 0
+		}
+		if n > maxPageSize {
+			fieldErrs = append(fieldErrs, FieldError{field, fmt.Sprintf("must be at most %d", maxPageSize)})
+			return 0
+		}
+		if limits.MaxSize > 0 && n > limits.MaxSize {
+			n = limits.MaxSize
+		}
+		return n
+	}
+	p.First = parseSize("first")
+	p.Last = parseSize("last")
+	if values.Get("first") != "" && values.Get("last") != "" {
+		fieldErrs = append(fieldErrs, FieldError{"last", "cannot be combined with first"})
+	}
+
+	p.AfterCursor = values.Get("after")
+	p.BeforeCursor = values.Get("before")
+	if p.AfterCursor != "" && p.BeforeCursor != "" {
+		fieldErrs = append(fieldErrs, FieldError{"before", "cannot be combined with after"})
+	}
+
+	if len(fieldErrs) > 0 {
+		return nil, &PaginatorError{Fields: fieldErrs}
+	}
+
+	if p.First == 0 && p.Last == 0 {
+		p.First = limits.DefaultSize
+		if p.First == 0 {
+			p.First = defaultPageSize
+		}
+		if limits.MaxSize > 0 && p.First > limits.MaxSize {
+			p.First = limits.MaxSize
+		}
+	}
+	return &p, nil
+}
+
 // Cursors can either be used as part of pagination input to a SELECT query
 // (as part of a Paginator), or new cursors provided as a result of the SELECT.
 type Cursors struct {
@@ -48,102 +158,202 @@ type Cursors struct {
 	BeforeCursor string
 }
 
+// PageInfo describes a page of results returned by PaginatedSelect, following
+// the GraphQL Cursor Connections specification. The embedded Cursors are set
+// to EndCursor and StartCursor only when there is a next or previous page
+// respectively.
+type PageInfo struct {
+	Cursors
+
+	HasNextPage     bool
+	HasPreviousPage bool
+
+	// StartCursor and EndCursor are the cursors of the first and last rows
+	// of the page, if it is not empty.
+	StartCursor string
+	EndCursor   string
+
+	// EdgeCursors holds the cursor of each row of the page when requested by
+	// Paginator.EdgeCursors.
+	EdgeCursors []string
+
+	// TotalCount is the number of rows across every page when requested by
+	// Paginator.Count, and TotalCountEstimated reports whether it is the
+	// planner's estimate rather than an exact count.
+	TotalCount          int64
+	TotalCountEstimated bool
+}
+
 var removeTablePrefix = regexp.MustCompile(`^(.*)\.`)
 
 func (q Query) WithPaginator(p *Paginator) (Query, error) {
-	cursorCol := q.CursorColumn()
-	if cursorCol == "" {
+	if q.CursorColumn() == "" {
 		return q, errors.New("cannot paginate query because it does not declare a cursor column")
 	}
+	if p == nil {
+		return q, errors.New("cannot paginate query without a paginator")
+	}
+	if p.First < 0 || p.Last < 0 || p.First > maxPageSize || p.Last > maxPageSize {
+		return q, fmt.Errorf("page size must be between 0 and %d", maxPageSize)
+	}
+	q.paginator = p
+	return q, nil
+}
+
+// paginate sets the pagination template parameters. It is deferred until the
+// query is rendered so that the cursor parameter follows any conditions
+// added by Where, regardless of the order they were added in.
+func (q Query) paginate() Query {
+	p := q.paginator
+	keys := q.CursorColumns()
+	cursorParam := q.NextParamNumber()
 
-	reverseOrder := false
-	ascOrDesc := q.AscendingOrDescending()
 	// Get an extra row so we can tell whether to include a pagination cursor
 	limit := p.First + 1
-	gtOrLt := ">"
+	reverseOrder := false
 	if p.Last != 0 {
 		limit = p.Last + 1
-		ascOrDesc = ascOrDesc.Reverse()
 		reverseOrder = true
 	}
-	if ascOrDesc == Descending {
-		gtOrLt = "<"
+
+	orders := make([]Order, len(keys))
+	for i, key := range keys {
+		orders[i] = key.Order
+		if reverseOrder {
+			orders[i] = orders[i].Reverse()
+		}
 	}
 
 	paginationWhere := "true"
-	if p.AfterCursor != "" {
-		paginationWhere = fmt.Sprintf(" %s %s $%d", cursorCol, gtOrLt, q.NextParamNumber())
-	} else if p.BeforeCursor != "" {
-		paginationWhere = fmt.Sprintf(" %s %s $%d", cursorCol, gtOrLt, q.NextParamNumber())
+	if p.AfterCursor != "" || p.BeforeCursor != "" {
+		paginationWhere = keysetCondition(keys, orders, cursorParam)
 	}
-	q = q.WithTemplateParameter("PaginationWhere", paginationWhere)
+	q = q.WithTemplateParameter("PaginationWhere", SQL(paginationWhere))
 
-	paginationOrderBy := fmt.Sprintf("%s %s LIMIT %d", cursorCol, ascOrDesc, limit)
-	q = q.WithTemplateParameter("PaginationOrderBy", paginationOrderBy)
+	orderBy := make([]string, len(keys))
+	for i, key := range keys {
+		orderBy[i] = fmt.Sprintf("%s %s", key.Column, orders[i])
+	}
+	paginationOrderBy := fmt.Sprintf("%s LIMIT %d", strings.Join(orderBy, ", "), limit)
+	q = q.WithTemplateParameter("PaginationOrderBy", SQL(paginationOrderBy))
 
 	if reverseOrder {
+		// The locking clause must stay with the inner query, since it
+		// cannot apply to the derived table.
+		if q.lock != "" {
+			q = q.WithSuffix(q.lock)
+			q.lock = ""
+		}
+
 		// Wrap the query so the DB gives us the page in the expected sort order
+		for i, key := range keys {
+			orderBy[i] = "unsorted." + removeTablePrefix.ReplaceAllLiteralString(key.Column, "") + " " + string(key.Order)
+		}
 		q = q.WithPrefix("SELECT * FROM (").
-			WithSuffix(") unsorted ORDER BY unsorted." +
-				removeTablePrefix.ReplaceAllLiteralString(cursorCol, "") + " " +
-				string(q.AscendingOrDescending()))
+			WithSuffix(") unsorted ORDER BY " + strings.Join(orderBy, ", "))
 	}
-	q.paginator = p
-	return q, nil
+	return q
+}
+
+// keysetCondition returns the condition selecting rows that sort after the
+// cursor bound to consecutive parameters from param. Columns sorted in the
+// same direction are compared as a row value, which postgres can satisfy with
+// a single index range; mixed directions expand to comparing each column in
+// turn while the ones before it are equal.
+func keysetCondition(keys []CursorKey, orders []Order, param int) string {
+	op := func(order Order) string {
+		if order == Descending {
+			return "<"
+		}
+		return ">"
+	}
+
+	mixed := false
+	for _, order := range orders {
+		if order != orders[0] {
+			mixed = true
+		}
+	}
+
+	if !mixed {
+		cols := make([]string, len(keys))
+		params := make([]string, len(keys))
+		for i, key := range keys {
+			cols[i] = key.Column
+			params[i] = fmt.Sprintf("$%d", param+i)
+		}
+		if len(keys) == 1 {
+			return fmt.Sprintf("%s %s %s", cols[0], op(orders[0]), params[0])
+		}
+		return fmt.Sprintf("(%s) %s (%s)", strings.Join(cols, ", "), op(orders[0]), strings.Join(params, ", "))
+	}
+
+	terms := make([]string, len(keys))
+	for i, key := range keys {
+		var conds []string
+		for j := 0; j < i; j++ {
+			conds = append(conds, fmt.Sprintf("%s = $%d", keys[j].Column, param+j))
+		}
+		conds = append(conds, fmt.Sprintf("%s %s $%d", key.Column, op(orders[i]), param+i))
+		terms[i] = "(" + strings.Join(conds, " AND ") + ")"
+	}
+	return "(" + strings.Join(terms, " OR ") + ")"
 }
 
-func extractCursors(p *Paginator, queryResults interface{}) (cursors Cursors, err error) {
+// extractPageInfo trims the extra row fetched to tell whether there is
+// another page from the query results, and returns the cursors of the page.
+func extractPageInfo(query Query, queryResults interface{}) (info PageInfo, err error) {
+	p := query.paginator
 	val := reflect.ValueOf(queryResults)
 	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Slice {
-		return Cursors{}, errors.New("query results are not a pointer to a slice")
+		return PageInfo{}, errors.New("query results are not a pointer to a slice")
+	}
+	rows := val.Elem()
+
+	if p.Last != 0 {
+		if int64(rows.Len()) > p.Last {
+			rows.Set(rows.Slice(1, rows.Len()))
+			info.HasPreviousPage = true
+		}
+		info.HasNextPage = p.BeforeCursor != ""
+	} else {
+		if int64(rows.Len()) > p.First {
+			rows.SetLen(rows.Len() - 1)
+			info.HasNextPage = true
+		}
+		info.HasPreviousPage = p.AfterCursor != ""
 	}
 
-	l := val.Elem().Len()
+	l := rows.Len()
 	if l == 0 {
-		return cursors, nil
+		return info, nil
 	}
 
-	if p.Last != 0 {
-		if p.BeforeCursor != "" {
-			cursors.AfterCursor, err = cursorFromValue(val.Elem().Index(l - 1))
-			if err != nil {
-				return
-			}
-		}
-		if int64(val.Elem().Len()) > p.Last {
-			cursors.BeforeCursor, err = cursorFromValue(val.Elem().Index(1))
+	if p.EdgeCursors {
+		info.EdgeCursors = make([]string, l)
+		for i := range info.EdgeCursors {
+			info.EdgeCursors[i], err = query.cursorFromRow(rows.Index(i))
 			if err != nil {
-				return
+				return PageInfo{}, err
 			}
-			val.Elem().Set(val.Elem().Slice(1, l))
 		}
+		info.StartCursor, info.EndCursor = info.EdgeCursors[0], info.EdgeCursors[l-1]
 	} else {
-		if p.AfterCursor != "" {
-			cursors.BeforeCursor, err = cursorFromValue(val.Elem().Index(0))
-			if err != nil {
-				return
-			}
+		info.StartCursor, err = query.cursorFromRow(rows.Index(0))
+		if err != nil {
+			return PageInfo{}, err
 		}
-		if int64(val.Elem().Len()) > p.First {
-			cursors.AfterCursor, err = cursorFromValue(val.Elem().Index(l - 2))
-			if err != nil {
-				return
-			}
-			val.Elem().SetLen(l - 1)
+		info.EndCursor, err = query.cursorFromRow(rows.Index(l - 1))
+		if err != nil {
+			return PageInfo{}, err
 		}
 	}
 
-	return cursors, nil
-}
-
-func cursorFromValue(v reflect.Value) (string, error) {
-	cursorMethod := v.MethodByName("ToCursor")
-	if !cursorMethod.IsValid() {
-		return "", errors.New("missing ToCursor method")
+	if info.HasPreviousPage {
+		info.BeforeCursor = info.StartCursor
 	}
-	returnVals := cursorMethod.Call(nil)
-	if len(returnVals) != 1 || returnVals[0].Kind() != reflect.String {
-		return "", errors.New("ToCursor did not return a string")
+	if info.HasNextPage {
+		info.AfterCursor = info.EndCursor
 	}
-	return returnVals[0].String(), nil
+	return info, nil
 }
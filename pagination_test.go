@@ -0,0 +1,239 @@
+package pge
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestKeysetCondition(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		keys   []CursorKey
+		orders []Order
+		want   string
+	}{
+		{
+			name:   "single ascending",
+			keys:   []CursorKey{{"id", Ascending}},
+			orders: []Order{Ascending},
+			want:   "id > $3",
+		},
+		{
+			name:   "single descending",
+			keys:   []CursorKey{{"id", Descending}},
+			orders: []Order{Descending},
+			want:   "id < $3",
+		},
+		{
+			name:   "row value",
+			keys:   []CursorKey{{"created", Descending}, {"id", Descending}},
+			orders: []Order{Descending, Descending},
+			want:   "(created, id) < ($3, $4)",
+		},
+		{
+			name:   "mixed directions",
+			keys:   []CursorKey{{"created", Descending}, {"id", Ascending}},
+			orders: []Order{Descending, Ascending},
+			want:   "((created < $3) OR (created = $3 AND id > $4))",
+		},
+		{
+			name:   "three mixed columns",
+			keys:   []CursorKey{{"a", Ascending}, {"b", Descending}, {"c", Ascending}},
+			orders: []Order{Ascending, Descending, Ascending},
+			want:   "((a > $3) OR (a = $3 AND b < $4) OR (a = $3 AND b = $4 AND c > $5))",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := keysetCondition(tc.keys, tc.orders, 3); got != tc.want {
+				t.Errorf("keysetCondition() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPaginateComposite(t *testing.T) {
+	q := newQuery("test paginate composite", `
+		SELECT * FROM t WHERE a = $1 AND {{.PaginationWhere}} ORDER BY {{.PaginationOrderBy}}
+	`, WithCursorColumns(CursorKey{"t.created", Descending}, CursorKey{"t.id", Descending}))
+
+	for _, tc := range []struct {
+		name string
+		p    Paginator
+		want string
+	}{
+		{
+			name: "first page",
+			p:    Paginator{First: 10},
+			want: "SELECT * FROM t WHERE a = $1 AND true ORDER BY t.created DESC, t.id DESC LIMIT 11",
+		},
+		{
+			name: "after",
+			p:    Paginator{First: 10, Cursors: Cursors{AfterCursor: "c"}},
+			want: "SELECT * FROM t WHERE a = $1 AND (t.created, t.id) < ($2, $3) ORDER BY t.created DESC, t.id DESC LIMIT 11",
+		},
+		{
+			name: "before",
+			p:    Paginator{Last: 5, Cursors: Cursors{BeforeCursor: "c"}},
+			want: "SELECT * FROM ( SELECT * FROM t WHERE a = $1 AND (t.created, t.id) > ($2, $3) ORDER BY t.created ASC, t.id ASC LIMIT 6 ) unsorted ORDER BY unsorted.created DESC, unsorted.id DESC",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pq, err := q.WithPaginator(&tc.p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := pq.Render()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("Render() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParsePaginator(t *testing.T) {
+	limits := PageLimits{DefaultSize: 10, MaxSize: 50}
+
+	for _, tc := range []struct {
+		name   string
+		query  string
+		limits PageLimits
+		want   *Paginator
+		errs   []FieldError
+	}{
+		{
+			name:   "default size",
+			query:  "",
+			limits: limits,
+			want:   &Paginator{First: 10},
+		},
+		{
+			name:  "package default size",
+			query: "",
+			want:  &Paginator{First: defaultPageSize},
+		},
+		{
+			name:   "first after",
+			query:  "first=5&after=abc",
+			limits: limits,
+			want:   &Paginator{First: 5, Cursors: Cursors{AfterCursor: "abc"}},
+		},
+		{
+			name:   "last before",
+			query:  "last=5&before=abc",
+			limits: limits,
+			want:   &Paginator{Last: 5, Cursors: Cursors{BeforeCursor: "abc"}},
+		},
+		{
+			name:   "default size with cursor",
+			query:  "after=abc",
+			limits: limits,
+			want:   &Paginator{First: 10, Cursors: Cursors{AfterCursor: "abc"}},
+		},
+		{
+			name:   "max size",
+			query:  "last=500",
+			limits: limits,
+			want:   &Paginator{Last: 50},
+		},
+		{
+			name:   "default size over max",
+			query:  "",
+			limits: PageLimits{DefaultSize: 100, MaxSize: 50},
+			want:   &Paginator{First: 50},
+		},
+		{
+			name:   "unlimited",
+			query:  "first=100000",
+			limits: PageLimits{},
+			want:   &Paginator{First: 100000},
+		},
+		{
+			name:   "overflow",
+			query:  "first=9223372036854775807",
+			limits: PageLimits{},
+			errs:   []FieldError{{"first", "must be at most 2147483647"}},
+		},
+		{
+			name:   "negative",
+			query:  "first=-1",
+			limits: limits,
+			errs:   []FieldError{{"first", "must be positive"}},
+		},
+		{
+			name:   "zero",
+			query:  "last=0",
+			limits: limits,
+			errs:   []FieldError{{"last", "must be positive"}},
+		},
+		{
+			name:   "not an integer",
+			query:  "first=ten",
+			limits: limits,
+			errs:   []FieldError{{"first", "must be an integer"}},
+		},
+		{
+			name:   "first and last",
+			query:  "first=1&last=1",
+			limits: limits,
+			errs:   []FieldError{{"last", "cannot be combined with first"}},
+		},
+		{
+			name:   "after and before",
+			query:  "after=a&before=b",
+			limits: limits,
+			errs:   []FieldError{{"before", "cannot be combined with after"}},
+		},
+		{
+			name:   "every error",
+			query:  "first=-1&last=x&after=a&before=b",
+			limits: limits,
+			errs: []FieldError{
+				{"first", "must be positive"},
+				{"last", "must be an integer"},
+				{"last", "cannot be combined with first"},
+				{"before", "cannot be combined with after"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p, err := ParsePaginator(values, tc.limits)
+			if tc.errs != nil {
+				var perr *PaginatorError
+				if !errors.As(err, &perr) {
+					t.Fatalf("ParsePaginator() error = %v, want *PaginatorError", err)
+				}
+				if !reflect.DeepEqual(perr.Fields, tc.errs) {
+					t.Errorf("ParsePaginator() field errors = %v, want %v", perr.Fields, tc.errs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(p, tc.want) {
+				t.Errorf("ParsePaginator() = %+v, want %+v", p, tc.want)
+			}
+		})
+	}
+}
+
+func TestParsePaginatorRoundTrip(t *testing.T) {
+	want := &Paginator{Last: 7, Cursors: Cursors{BeforeCursor: "abc"}}
+	got, err := ParsePaginator(want.QueryParams(), PageLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParsePaginator(QueryParams()) = %+v, want %+v", got, want)
+	}
+}
@@ -2,6 +2,8 @@ package pge
 
 import (
 	"context"
+	"fmt"
+	"reflect"
 
 	"github.com/georgysavva/scany/pgxscan"
 	"github.com/jackc/pgconn"
@@ -11,7 +13,7 @@ import (
 // Listen takes a *pgx.Conn as an argument because we want the LISTEN to be
 // effective for a specific connection.
 func Listen(ctx context.Context, conn *pgx.Conn, channel string) error {
-	return sqlQuery(ctx, NewQuery("LISTEN", ""), func(ctx context.Context) error {
+	return sqlQuery(ctx, newQuery("LISTEN", ""), func(ctx context.Context) error {
 		_, err := conn.Exec(ctx, "LISTEN "+channel)
 		return err
 	})
@@ -20,70 +22,152 @@ func Listen(ctx context.Context, conn *pgx.Conn, channel string) error {
 // Unlisten takes a *pgx.Conn as an argument because we want the UNLISTEN to be
 // effective for a specific connection.
 func Unlisten(ctx context.Context, conn *pgx.Conn, channel string) error {
-	return sqlQuery(ctx, NewQuery("UNLISTEN", ""), func(ctx context.Context) error {
+	return sqlQuery(ctx, newQuery("UNLISTEN", ""), func(ctx context.Context) error {
 		_, err := conn.Exec(ctx, "UNLISTEN "+channel)
 		return err
 	})
 }
 
-func pgExec(ctx context.Context, q queryable, query Query, args ...interface{}) (pgconn.CommandTag, error) {
+func pgExec(ctx context.Context, info *StoreInfo, q queryable, query Query, args ...interface{}) (pgconn.CommandTag, error) {
 	var tag pgconn.CommandTag
 	err := sqlQuery(ctx, query, func(ctx context.Context) error {
-		var err error
-		tag, err = q.Exec(ctx, query.String(), args...)
-		return err
+		return withStatement(ctx, info, q, query, args, func(q queryable, sql string, args []interface{}) error {
+			var err error
+			tag, err = q.Exec(ctx, sql, args...)
+			return err
+		})
 	})
 	return tag, err
 }
 
-func pgGet(ctx context.Context, q queryable, dst interface{}, query Query, args ...interface{}) error {
+func pgGet(ctx context.Context, info *StoreInfo, q queryable, dst interface{}, query Query, args ...interface{}) error {
 	return sqlQuery(ctx, query, func(ctx context.Context) error {
-		return pgxscan.Get(ctx, q, dst, query.String(), args...)
+		return withStatement(ctx, info, q, query, args, func(q queryable, sql string, args []interface{}) error {
+			return pgxscan.Get(ctx, q, dst, sql, args...)
+		})
 	})
 }
 
-func pgSelect(ctx context.Context, q queryable, dst interface{}, query Query, args ...interface{}) error {
+func pgSelect(ctx context.Context, info *StoreInfo, q queryable, dst interface{}, query Query, args ...interface{}) error {
 	return sqlQuery(ctx, query, func(ctx context.Context) error {
-		return pgxscan.Select(ctx, q, dst, query.String(), args...)
+		return withStatement(ctx, info, q, query, args, func(q queryable, sql string, args []interface{}) error {
+			return pgxscan.Select(ctx, q, dst, sql, args...)
+		})
 	})
 }
 
-func pgPaginatedSelect(ctx context.Context, q queryable, dst interface{}, query Query, args ...interface{}) (Cursors, error) {
-	if query.paginator != nil {
-		if query.paginator.AfterCursor != "" {
-			cursor, err := query.CursorFromString(query.paginator.AfterCursor)
+func pgPaginatedSelect(ctx context.Context, info *StoreInfo, q queryable, dst interface{}, query Query, args ...interface{}) (PageInfo, error) {
+	query, err := query.withCursorArgs()
+	if err != nil {
+		return PageInfo{}, err
+	}
+
+	err = pgSelect(ctx, info, q, dst, query, args...)
+	if err != nil {
+		return PageInfo{}, err
+	}
+	page, err := extractPageInfo(query, dst)
+	if err != nil {
+		return PageInfo{}, err
+	}
+
+	rows := reflect.ValueOf(dst).Elem().Len()
+	err = countRows(ctx, info, q, query, &page, rows, args...)
+	if err != nil {
+		return PageInfo{}, err
+	}
+	return page, nil
+}
+
+func pgInsert(ctx context.Context, info *StoreInfo, q queryable, dst interface{}, query Query, src interface{}) error {
+	v := reflect.Indirect(reflect.ValueOf(src))
+	if v.Kind() != reflect.Slice {
+		args, err := StructArgs(query, src)
+		if err != nil {
+			return &QueryError{query, err}
+		}
+		if len(query.unnestTypes) > 0 {
+			args, err = transpose([][]interface{}{args}, len(args))
 			if err != nil {
-				return Cursors{}, err
+				return &QueryError{query, err}
 			}
-			args = append(args, cursor)
-		} else if query.paginator.BeforeCursor != "" {
-			cursor, err := query.CursorFromString(query.paginator.BeforeCursor)
+		}
+		if dst == nil {
+			_, err = pgExec(ctx, info, q, query, args...)
+			return err
+		}
+		return pgGet(ctx, info, q, dst, query, args...)
+	}
+
+	var results reflect.Value
+	if dst != nil {
+		results = reflect.ValueOf(dst)
+		if results.Kind() != reflect.Ptr || results.Elem().Kind() != reflect.Slice {
+			return &QueryError{query, fmt.Errorf("inserting a slice requires a pointer to a slice destination, got %T", dst)}
+		}
+		results = results.Elem()
+	}
+
+	_, err := Bulk(v.Len(), query.insertBatchSize(), func(i, j int) error {
+		rows := make([][]interface{}, 0, j-i)
+		for k := i; k < j; k++ {
+			rowArgs, err := StructArgs(query, v.Index(k).Interface())
 			if err != nil {
-				return Cursors{}, err
+				return &QueryError{query, fmt.Errorf("row %d: %w", k, err)}
 			}
-			args = append(args, cursor)
+			rows = append(rows, rowArgs)
 		}
-	}
 
-	err := sqlQuery(ctx, query, func(ctx context.Context) error {
-		return pgxscan.Select(ctx, q, dst, query.String(), args...)
+		batchQuery, args, err := query.insertBatch(rows)
+		if err != nil {
+			return &QueryError{query, err}
+		}
+		if dst == nil {
+			_, err := pgExec(ctx, info, q, batchQuery, args...)
+			return err
+		}
+
+		batch := reflect.New(results.Type())
+		err = pgSelect(ctx, info, q, batch.Interface(), batchQuery, args...)
+		if err != nil {
+			return err
+		}
+		results.Set(reflect.AppendSlice(results, batch.Elem()))
+		return nil
 	})
-	if err != nil {
-		return Cursors{}, err
-	}
-	return extractCursors(query.paginator, dst)
+	return err
 }
 
+// bulkBatchSize is the number of rows inserted by each statement of a bulk
+// insert.
+const bulkBatchSize = 100
+
+// BulkInsert inserts numRows rows in batches, calling fn for the arguments of
+// each row, and returns the rows returned by the query. Statements are not
+// tagged with query comments unless q is a Tx; use Conn.BulkInsert to tag
+// them with the Store's comments.
 func BulkInsert(ctx context.Context, numRows int, q queryable, query Query, fn func(int) []interface{}) (results []interface{}, err error) {
+	var info *StoreInfo
+	if t, ok := q.(tx); ok {
+		info, q = t.info, t.Tx
+	}
+	return pgBulkInsert(ctx, info, q, numRows, query, fn)
+}
+
+func pgBulkInsert(ctx context.Context, info *StoreInfo, q queryable, numRows int, query Query, fn func(int) []interface{}) (results []interface{}, err error) {
 	results = make([]interface{}, numRows)
-	n, err := Bulk(numRows, 100, func(i, j int) error {
-		var args []interface{}
+	n, err := Bulk(numRows, query.insertBatchSize(), func(i, j int) error {
+		rows := make([][]interface{}, 0, j-i)
 		for k := i; k < j; k++ {
-			args = append(args, fn(k)...)
+			rows = append(rows, fn(k))
 		}
 
+		batchQuery, args, err := query.insertBatch(rows)
+		if err != nil {
+			return &QueryError{query, err}
+		}
 		var batch []interface{}
-		err := pgSelect(ctx, q, &batch, query.WithValues(j-i), args...)
+		err = pgSelect(ctx, info, q, &batch, batchQuery, args...)
 		if err != nil {
 			return err
 		}
@@ -131,9 +215,9 @@ func (e *QueryError) Unwrap() error {
 }
 
 func sqlQuery(ctx context.Context, query Query, f func(context.Context) error) error {
-	err := f(ctx)
+	err := withTimeout(ctx, query, f)
 	if err != nil {
-		return &QueryError{query, err}
+		return &QueryError{query, classifyLockError(err)}
 	}
 	return nil
 }
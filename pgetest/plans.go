@@ -0,0 +1,151 @@
+// Package pgetest provides helpers for testing pge queries against a real
+// database.
+package pgetest
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hinshun/pge"
+)
+
+var selectTableRows = pge.NewQuery("pgetest: select table rows", `
+	SELECT COALESCE(
+		(SELECT reltuples FROM pg_class WHERE oid = to_regclass($1)),
+		0
+	)::float8
+`)
+
+// PlanCheck configures CheckPlans.
+type PlanCheck struct {
+	// Args are representative arguments for queries by name. Queries that
+	// take parameters are skipped unless they have args.
+	Args map[string][]interface{}
+
+	// TemplateParameters are the template parameters of queries by name,
+	// for queries rendering parameters of their own such as {{.Table}}.
+	TemplateParameters map[string]map[string]interface{}
+
+	// MaxSeqScanRows fails plans with a sequential scan on a table the
+	// planner estimates to hold more rows than this. Zero disables the
+	// check.
+	MaxSeqScanRows float64
+
+	// MaxCost fails plans whose total cost exceeds it. Zero disables the
+	// check.
+	MaxCost float64
+
+	// Costs overrides MaxCost for queries by name.
+	Costs map[string]float64
+
+	// Paginator is applied to queries with a cursor column. Defaults to the
+	// first 20 rows.
+	Paginator *pge.Paginator
+
+	// Skip lists the names of queries not to check.
+	Skip []string
+}
+
+// CheckPlans runs EXPLAIN for every registered Query that is a SELECT, INSERT,
+// UPDATE, DELETE, WITH or VALUES statement, and reports an error through t
+// for plans that scan a large table sequentially or exceed their cost
+// budget. The database behind store should be seeded with representative
+// data and analyzed, since plans depend on table statistics.
+func CheckPlans(ctx context.Context, t testing.TB, store pge.Store, check PlanCheck) {
+	t.Helper()
+
+	skip := map[string]bool{selectTableRows.Name: true}
+	for _, name := range check.Skip {
+		skip[name] = true
+	}
+
+	paginator := check.Paginator
+	if paginator == nil {
+		paginator = &pge.Paginator{First: 20}
+	}
+
+	for _, q := range pge.Queries() {
+		if skip[q.Name] {
+			continue
+		}
+
+		args, ok := check.Args[q.Name]
+		if !ok && (q.NextParamNumber() > 1 || q.InsertColumns() > 0) {
+			continue
+		}
+
+		for param, value := range check.TemplateParameters[q.Name] {
+			q = q.WithTemplateParameter(param, value)
+		}
+
+		if q.CursorColumn() != "" {
+			var err error
+			q, err = q.WithPaginator(paginator)
+			if err != nil {
+				t.Errorf("%s: %s", q.Name, err)
+				continue
+			}
+		}
+
+		sql, err := q.Render()
+		if err != nil {
+			t.Errorf("%s: %s", q.Name, err)
+			continue
+		}
+		if !explainable(sql) {
+			continue
+		}
+
+		plan, err := store.Explain(ctx, q, args...)
+		if err != nil {
+			t.Errorf("%s: %s", q.Name, err)
+			continue
+		}
+		checkPlan(ctx, t, store, check, q, plan)
+	}
+}
+
+func checkPlan(ctx context.Context, t testing.TB, store pge.Store, check PlanCheck, q pge.Query, plan *pge.Plan) {
+	t.Helper()
+
+	maxCost := check.MaxCost
+	if cost, ok := check.Costs[q.Name]; ok {
+		maxCost = cost
+	}
+	if maxCost > 0 && plan.Root.TotalCost > maxCost {
+		t.Errorf("%s: plan cost %.2f exceeds budget of %.2f", q.Name, plan.Root.TotalCost, maxCost)
+	}
+
+	if check.MaxSeqScanRows <= 0 {
+		return
+	}
+	for _, scan := range plan.SeqScans() {
+		relation := scan.RelationName
+		if scan.Schema != "" {
+			relation = scan.Schema + "." + relation
+		}
+
+		var rows float64
+		err := store.Get(ctx, &rows, selectTableRows, relation)
+		if err != nil {
+			t.Errorf("%s: %s", q.Name, err)
+			continue
+		}
+		if rows > check.MaxSeqScanRows {
+			t.Errorf("%s: sequential scan on %s with an estimated %.0f rows exceeds %.0f", q.Name, relation, rows, check.MaxSeqScanRows)
+		}
+	}
+}
+
+func explainable(sql string) bool {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return false
+	}
+	switch strings.ToUpper(strings.TrimLeft(fields[0], "(")) {
+	case "SELECT", "INSERT", "UPDATE", "DELETE", "WITH", "VALUES":
+		return true
+	}
+	return false
+}
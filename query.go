@@ -2,16 +2,14 @@ package pge
 
 import (
 	"bytes"
-	"regexp"
+	"fmt"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"text/template"
-)
-
-var (
-	spacePattern = regexp.MustCompile(`\s+`)
-
-	removeCommentsRegexp = regexp.MustCompile(`((?m)--.*$)`)
+	"time"
 )
 
 type QueryOption func(*Query)
@@ -28,11 +26,37 @@ func WithSuffix(suffix string) QueryOption {
 	}
 }
 
+// WithCursorColumn declares the column a query is paginated by. The cursor is
+// bound to the parameter following those the query takes and any conditions
+// added by Where. The query is assumed to take at least paramNumber-1
+// parameters, which matters when its placeholders are generated by template
+// parameters and cannot be counted.
 func WithCursorColumn(column string, paramNumber int, ascendingOrDescending Order) QueryOption {
 	return func(q *Query) {
-		q.cursorCol = column
-		q.nextParamNumber = paramNumber
-		q.ascendingOrDescending = ascendingOrDescending
+		WithCursorColumns(CursorKey{Column: column, Order: ascendingOrDescending})(q)
+		WithParamCount(paramNumber - 1)(q)
+	}
+}
+
+// WithParamCount declares that the query takes at least n parameters. The
+// parameters of a query are counted from its $n placeholders, including those
+// generated by the placeholders template function with constant arguments,
+// but placeholders in template parameters are only known once rendered. This
+// decides where conditions added by Where and pagination cursors are bound.
+func WithParamCount(n int) QueryOption {
+	return func(q *Query) {
+		if n > q.queryParams {
+			q.queryParams = n
+		}
+	}
+}
+
+// WithCursorColumns declares the columns a query is paginated by, in sort
+// order. Later columns break ties between rows sharing the earlier ones, so
+// the last should be unique, such as a primary key.
+func WithCursorColumns(keys ...CursorKey) QueryOption {
+	return func(q *Query) {
+		q.cursorKeys = keys
 	}
 }
 
@@ -43,60 +67,185 @@ func WithCursorFromString(cursorFromString func(string) (interface{}, error)) Qu
 }
 
 type Query struct {
-	Name                  string
-
-	query                 string
-	insertCols            int
-	prefix                string
-	suffix                string
-	cursorCol             string
-	nextParamNumber       int
-	cursorFromString      func(string) (interface{}, error)
-	ascendingOrDescending Order
-	paginator             *Paginator
-	tmpl                  *template.Template
-	templateParams        map[string]interface{}
+	Name string
+
+	query            string
+	queryParams      int
+	insertCols       int
+	insertColNames   []string
+	onConflict       *onConflict
+	unnestTypes      []string
+	prefix           string
+	suffix           string
+	cursorKeys       []CursorKey
+	cursorFromString func(string) (interface{}, error)
+	cursorCodec      CursorCodec
+	paginator        *Paginator
+	timeout          time.Duration
+	explain          string
+	lock             string
+	statementTimeout bool
+	tmpl             *template.Template
+	templateParams   map[string]interface{}
+	filters          []string
+	args             []interface{}
+	cursorArgs       []interface{}
+	ctes             []string
+	unions           []string
+	err              error
+
+	// cache is shared by every copy of a query returned by its With methods.
+	cache *queryCache
+
+	// variant distinguishes the prepared statements of queries derived from
+	// the same declaration, such as WithValues for different row counts.
+	variant string
+
+	// file and line record where the query was declared.
+	file string
+	line int
 }
 
+// NewQuery creates a Query and records it in the registry along with the
+// source location it was declared at. It panics if another call site has
+// already registered a query with the same name.
 func NewQuery(name, query string, opts ...QueryOption) Query {
+	q := newQuery(name, query, opts...)
+	_, q.file, q.line, _ = runtime.Caller(1)
+	if err := register(q); err != nil {
+		panic(fmt.Sprintf("pge: %s", err))
+	}
+	return q
+}
+
+func newQuery(name, query string, opts ...QueryOption) Query {
 	q := Query{
 		Name:  name,
 		query: query,
+		cache: newQueryCache(),
 	}
-	q.query = removeCommentsRegexp.ReplaceAllString(query, "")
+	// Trailing semicolons are dropped so that the query can be wrapped by
+	// unions, common table expressions, locking clauses and pagination.
+	q.query = strings.TrimRight(stripComments(query), "; \t\r\n")
+	q.queryParams = maxPlaceholder(q.query)
 	for _, opt := range opts {
 		opt(&q)
 	}
-	q.tmpl = template.Must(template.New("query").Parse(q.query))
+	if err := q.validateOnConflict(); err != nil {
+		panic(fmt.Sprintf("pge: %s", err))
+	}
+	if err := q.validateUnnest(); err != nil {
+		panic(fmt.Sprintf("pge: %s", err))
+	}
+	q.tmpl = template.Must(template.New("query").Option("missingkey=error").Funcs(funcs).Parse(q.query))
+	if n := maxTemplatePlaceholder(q.tmpl.Tree.Root); n > q.queryParams {
+		q.queryParams = n
+	}
 	return q
 }
 
+// String returns the rendered SQL, or the unrendered query text if the
+// template cannot be executed. Use Render when the error matters.
 func (q Query) String() string {
-	if q.insertCols > 0 {
+	sql, err := q.Render()
+	if err != nil {
+		return collapseSpace(q.prefix + q.query + q.suffix)
+	}
+	return sql
+}
+
+// Render executes the query template with its template parameters and
+// returns the SQL to send to the database. Referencing a template parameter
+// that has not been set with WithTemplateParameter is an error.
+func (q Query) Render() (string, error) {
+	if q.err != nil {
+		return "", q.err
+	}
+	if len(q.unnestTypes) > 0 {
+		q = q.withUnnest()
+	} else if q.insertCols > 0 {
 		q = q.WithValues(1)
 	}
-	var buf bytes.Buffer
-	err := q.tmpl.Execute(&buf, q.templateParams)
+	if q.paginator != nil {
+		q = q.paginate()
+	}
+	q = q.WithTemplateParameter("Filters", SQL(q.filterExpression()))
+	if q.cache == nil {
+		return q.render()
+	}
+
+	key := q.renderKey()
+	if sql, ok := q.cache.rendered.Load(key); ok {
+		return sql.(string), nil
+	}
+	sql, err := q.render()
 	if err != nil {
-		return trimString(q.prefix + q.query + q.suffix)
+		return "", err
+	}
+	q.cache.rendered.Store(key, sql)
+	return sql, nil
+}
+
+func (q Query) render() (string, error) {
+	query := q.query
+	if q.tmpl != nil {
+		var buf bytes.Buffer
+		err := q.tmpl.Execute(&buf, q.templateParams)
+		if err != nil {
+			return "", err
+		}
+		query = buf.String()
 	}
-	return trimString(q.prefix + buf.String() + q.suffix)
+
+	sql := q.prefix + query + q.suffix
+	if q.lock != "" {
+		if len(q.unions) > 0 {
+			return "", fmt.Errorf("%s cannot be combined with UNION", q.lock)
+		}
+		sql += " " + q.lock
+	}
+	sql = q.compose(sql)
+	if q.explain != "" {
+		sql = q.explain + " " + sql
+	}
+	return collapseSpace(sql), nil
+}
+
+// Source returns the file and line the query was declared at.
+func (q Query) Source() (file string, line int) {
+	return q.file, q.line
 }
 
+func (q Query) InsertColumns() int {
+	return q.insertCols
+}
+
+// CursorColumn returns the first column the query is paginated by.
 func (q Query) CursorColumn() string {
-	return q.cursorCol
+	if len(q.cursorKeys) == 0 {
+		return ""
+	}
+	return q.cursorKeys[0].Column
 }
 
-func (q Query) NextParamNumber() int {
-	return q.nextParamNumber
+// CursorColumns returns the columns the query is paginated by.
+func (q Query) CursorColumns() []CursorKey {
+	return q.cursorKeys
 }
 
-func (q Query) AscendingOrDescending() Order {
-	return q.ascendingOrDescending
+// NextParamNumber returns the number of the parameter following those the
+// query expects, which is where a pagination cursor is bound. Composite
+// cursors are bound to consecutive parameters from there.
+func (q Query) NextParamNumber() int {
+	return q.paramCount() + 1
 }
 
-func trimString(qStr string) string {
-	return spacePattern.ReplaceAllString(strings.TrimSpace(qStr), " ")
+// AscendingOrDescending returns the order of the first cursor column.
+func (q Query) AscendingOrDescending() Order {
+	if len(q.cursorKeys) == 0 {
+		return ""
+	}
+	return q.cursorKeys[0].Order
 }
 
 func (q Query) WithPrefix(prefix string) Query {
@@ -109,7 +258,14 @@ func (q Query) WithSuffix(suffix string) Query {
 	return q
 }
 
+// WithTemplateParameter sets a value for the query template. Values are
+// rendered verbatim, so only Identifier, Literal, SQL, booleans, numbers and
+// slices of them are accepted. Strings must be wrapped in one of the pge
+// types, which declare how they should be quoted.
 func (q Query) WithTemplateParameter(param string, paramValue interface{}) Query {
+	if err := checkTemplateParameter(param, paramValue); err != nil && q.err == nil {
+		q.err = err
+	}
 	updatedParams := make(map[string]interface{})
 	for k, v := range q.templateParams {
 		updatedParams[k] = v
@@ -123,6 +279,64 @@ func (q Query) WithValues(rows int) Query {
 	if rows == 0 {
 		return q
 	}
+	return q.withComposition(q.valuesQuery(rows), (rows-1)*q.insertCols)
+}
+
+func (q Query) valuesQuery(rows int) Query {
+	if q.cache == nil {
+		return q.withValues(rows)
+	}
+
+	key := strconv.Itoa(rows) + "\x00" + q.prefix + "\x00" + q.suffix
+	if values, ok := q.cache.values.Load(key); ok {
+		return values.(Query)
+	}
+	values := q.withValues(rows)
+	q.cache.values.Store(key, values)
+	return values
+}
+
+// withComposition copies the conditions, template parameters, bound
+// arguments and common table expressions composed into an insert query onto
+// the query generated from it to insert rows. Their placeholders follow the
+// values of a single row, so they are shifted past the values of the others.
+func (q Query) withComposition(rows Query, shift int) Query {
+	renumber := func(sql string) string {
+		if shift == 0 {
+			return sql
+		}
+		return rewritePlaceholders(sql, func(n int) string {
+			if n > q.insertCols {
+				n += shift
+			}
+			return "$" + strconv.Itoa(n)
+		})
+	}
+
+	for _, filter := range q.filters {
+		rows.filters = append(rows.filters, renumber(filter))
+	}
+	for _, cte := range q.ctes {
+		rows.ctes = append(rows.ctes, renumber(cte))
+	}
+	for _, union := range q.unions {
+		rows.unions = append(rows.unions, renumber(union))
+	}
+	for k, v := range q.templateParams {
+		if sql, ok := v.(SQL); ok {
+			v = SQL(renumber(string(sql)))
+		}
+		rows = rows.WithTemplateParameter(k, v)
+	}
+	rows.args = q.args
+	rows.timeout = q.timeout
+	rows.statementTimeout = q.statementTimeout
+	rows.explain = q.explain
+	rows.err = q.err
+	return rows
+}
+
+func (q Query) withValues(rows int) Query {
 
 	cols := q.insertCols
 
@@ -130,14 +344,19 @@ func (q Query) WithValues(rows int) Query {
 
 	// For each row, we write `(),` = 3*rows
 	// For each col, we write `$,` = 2*rows*cols
-	query := spacePattern.ReplaceAllString(strings.TrimSpace(q.query), " ")
-	prefix := spacePattern.ReplaceAllString(strings.TrimSpace(q.prefix), " ")
-	suffix := spacePattern.ReplaceAllString(strings.TrimSpace(q.suffix), " ")
+	query := collapseSpace(q.query)
+	prefix := collapseSpace(q.prefix)
+	suffix := collapseSpace(q.suffix)
 	length := len(prefix) + len(query) + 3*rows + 2*rows*cols + numDigits(rows*cols) + len(suffix)
 	b.Grow(length)
 
 	b.WriteString(prefix)
 	b.WriteString(query)
+	if len(q.insertColNames) > 0 {
+		b.WriteString(" (")
+		b.WriteString(strings.Join(q.insertColNames, ", "))
+		b.WriteString(")")
+	}
 	b.WriteString(" VALUES ")
 
 	for i := 0; i < rows; i++ {
@@ -155,19 +374,123 @@ func (q Query) WithValues(rows int) Query {
 		}
 	}
 
+	if q.onConflict != nil {
+		b.WriteString(" ")
+		b.WriteString(q.onConflict.String())
+	}
+
 	b.WriteString(" ")
 	b.WriteString(suffix)
 
-	return NewQuery(q.Name, b.String())
+	values := newQuery(q.Name, b.String())
+	values.file, values.line = q.file, q.line
+	values.variant = fmt.Sprintf("values%d", rows)
+	return values
 }
 
 // CursorFromString converts a cursor from a string to the format we want to
-// compare in the DB query.
+// compare in the DB query. Cursors over several columns are converted to a
+// []interface{} holding a value for each column. Cursors that cannot be
+// converted return an error matching ErrInvalidCursor.
 func (q Query) CursorFromString(cursor string) (interface{}, error) {
-	if q.cursorFromString == nil {
+	if q.cursorCodec != nil {
+		var err error
+		cursor, err = q.cursorCodec.Decode(cursor)
+		if err != nil {
+			return nil, asInvalidCursor(err)
+		}
+	}
+
+	if q.cursorFromString != nil {
+		v, err := q.cursorFromString(cursor)
+		if err != nil {
+			return nil, asInvalidCursor(err)
+		}
+		return v, nil
+	}
+	if len(q.cursorKeys) <= 1 {
 		return cursor, nil
 	}
-	return q.cursorFromString(cursor)
+
+	values, err := DecodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return args, nil
+}
+
+// queryCache memoizes the SQL rendered for each distinct set of template
+// parameters, and the queries generated by WithValues for each row count.
+type queryCache struct {
+	rendered boundedMap
+	values   boundedMap
+}
+
+func newQueryCache() *queryCache {
+	return &queryCache{
+		rendered: boundedMap{entries: make(map[string]interface{})},
+		values:   boundedMap{entries: make(map[string]interface{})},
+	}
+}
+
+// maxCachedEntries bounds the number of renderings kept per query, since
+// template parameters such as page sizes may come from user input.
+const maxCachedEntries = 256
+
+type boundedMap struct {
+	mu      sync.RWMutex
+	entries map[string]interface{}
+}
+
+func (m *boundedMap) Load(key string) (interface{}, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	v, ok := m.entries[key]
+	return v, ok
+}
+
+func (m *boundedMap) Store(key string, v interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.entries) >= maxCachedEntries {
+		m.entries = make(map[string]interface{})
+	}
+	m.entries[key] = v
+}
+
+// renderKey identifies everything that affects the output of render besides
+// the query text itself.
+func (q Query) renderKey() string {
+	keys := make([]string, 0, len(q.templateParams))
+	for k := range q.templateParams {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(q.explain)
+	b.WriteString("\x00")
+	b.WriteString(q.prefix)
+	b.WriteString("\x00")
+	b.WriteString(q.suffix)
+	b.WriteString("\x00")
+	b.WriteString(q.lock)
+	for _, sql := range q.ctes {
+		b.WriteString("\x00")
+		b.WriteString(sql)
+	}
+	for _, sql := range q.unions {
+		b.WriteString("\x00")
+		b.WriteString(sql)
+	}
+	for _, k := range keys {
+		fmt.Fprintf(&b, "\x00%s=%T:%v", k, q.templateParams[k], q.templateParams[k])
+	}
+	return b.String()
 }
 
 type Order string
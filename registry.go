@@ -0,0 +1,57 @@
+package pge
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// registry records every Query created by NewQuery so that tooling can
+// enumerate the SQL a program is able to execute.
+var registry = struct {
+	sync.RWMutex
+	queries map[string]Query
+}{
+	queries: make(map[string]Query),
+}
+
+// register adds q to the registry. Registering the same name twice from the
+// same source location is allowed so that queries constructed inside
+// functions do not collide with themselves, but two different call sites
+// sharing a name are reported as duplicates.
+func register(q Query) error {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if existing, ok := registry.queries[q.Name]; ok {
+		if existing.file != q.file || existing.line != q.line {
+			return fmt.Errorf("duplicate query name %q declared at %s:%d and %s:%d", q.Name, existing.file, existing.line, q.file, q.line)
+		}
+	}
+	registry.queries[q.Name] = q
+	return nil
+}
+
+// Queries returns every registered Query sorted by name.
+func Queries() []Query {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	queries := make([]Query, 0, len(registry.queries))
+	for _, q := range registry.queries {
+		queries = append(queries, q)
+	}
+	sort.Slice(queries, func(i, j int) bool {
+		return queries[i].Name < queries[j].Name
+	})
+	return queries
+}
+
+// LookupQuery returns the registered Query with the given name.
+func LookupQuery(name string) (Query, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	q, ok := registry.queries[name]
+	return q, ok
+}
@@ -0,0 +1,315 @@
+package pge
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// LoadQueries reads queries from the .sql files in fsys matching patterns,
+// or every .sql file at the root of fsys if no patterns are given. Each query
+// is introduced by a `-- name:` comment, optionally followed by annotation
+// comments that configure it:
+//
+//	-- name: SelectCustomers
+//	-- cursor: id desc
+//	SELECT * FROM customers WHERE {{.PaginationWhere}} ORDER BY {{.PaginationOrderBy}};
+//
+//	-- name: InsertProduct
+//	-- insert-columns: sku, product_name, price
+//	-- on-conflict: sku do update
+//	-- suffix: RETURNING id
+//	INSERT INTO products;
+//
+// The supported annotations are cursor (comma separated columns, each with an
+// optional asc or desc), insert-columns, unnest (the types of the insert
+// columns, to insert arrays with WithUnnest), on-conflict (target columns
+// followed by "do nothing", "do update" or "do update set" and the columns to
+// update), lock (such as "for update skip locked"), timeout and
+// statement-timeout (durations such as 5s) and suffix, which may be repeated.
+// Loaded queries are registered like those created by NewQuery.
+func LoadQueries(fsys fs.FS, patterns ...string) (map[string]Query, error) {
+	if len(patterns) == 0 {
+		patterns = []string{"*.sql"}
+	}
+
+	queries := make(map[string]Query)
+	for _, pattern := range patterns {
+		filenames, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, filename := range filenames {
+			src, err := fs.ReadFile(fsys, filename)
+			if err != nil {
+				return nil, err
+			}
+
+			parsed, err := ParseQueries(filename, string(src))
+			if err != nil {
+				return nil, err
+			}
+			for _, q := range parsed {
+				if err := register(q); err != nil {
+					return nil, err
+				}
+				queries[q.Name] = q
+			}
+		}
+	}
+	return queries, nil
+}
+
+// ParseQueries parses the annotated queries in src as described by
+// LoadQueries, without registering them. filename is only used for error
+// messages and source locations.
+func ParseQueries(filename, src string) ([]Query, error) {
+	var (
+		queries []Query
+		current *sqlFileQuery
+		line    = 1
+	)
+
+	flush := func() error {
+		if current == nil {
+			return nil
+		}
+		q, err := current.query()
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", filename, current.line, err)
+		}
+		q.file, q.line = filename, current.line
+		queries = append(queries, q)
+		return nil
+	}
+
+	for _, tok := range lexSQL(src) {
+		if tok.kind == tokenComment {
+			key, value, ok := parseAnnotation(tok.text)
+			switch {
+			case ok && key == "name":
+				if err := flush(); err != nil {
+					return nil, err
+				}
+				current = &sqlFileQuery{name: value, line: line}
+				continue
+			case ok && current != nil && !current.started:
+				current.annotations = append(current.annotations, sqlAnnotation{key, value, line})
+				continue
+			}
+		}
+
+		if current == nil {
+			if tok.kind != tokenSpace && tok.kind != tokenComment {
+				return nil, fmt.Errorf("%s:%d: query is missing a `-- name:` annotation", filename, line)
+			}
+		} else {
+			current.body.WriteString(tok.text)
+			if tok.kind != tokenSpace && tok.kind != tokenComment {
+				current.started = true
+			}
+		}
+		line += strings.Count(tok.text, "\n")
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return queries, nil
+}
+
+type sqlFileQuery struct {
+	name        string
+	line        int
+	annotations []sqlAnnotation
+	body        strings.Builder
+
+	// started is set once the body has more than space and comments, after
+	// which annotations are no longer parsed.
+	started bool
+}
+
+type sqlAnnotation struct {
+	key   string
+	value string
+	line  int
+}
+
+// annotationKeys are the keys of `-- key: value` comments that are parsed as
+// annotations. Other comments, such as `-- TODO: ...`, are left alone.
+var annotationKeys = map[string]bool{
+	"name":              true,
+	"cursor":            true,
+	"insert-columns":    true,
+	"unnest":            true,
+	"on-conflict":       true,
+	"timeout":           true,
+	"statement-timeout": true,
+	"lock":              true,
+	"suffix":            true,
+}
+
+// parseAnnotation parses a `-- key: value` comment with one of the
+// annotationKeys.
+func parseAnnotation(comment string) (key, value string, ok bool) {
+	if !strings.HasPrefix(comment, "--") {
+		return "", "", false
+	}
+	comment = strings.TrimSpace(strings.TrimPrefix(comment, "--"))
+	i := strings.IndexByte(comment, ':')
+	if i <= 0 {
+		return "", "", false
+	}
+	key = strings.ToLower(comment[:i])
+	if !annotationKeys[key] {
+		return "", "", false
+	}
+	return key, strings.TrimSpace(comment[i+1:]), true
+}
+
+func (f *sqlFileQuery) query() (q Query, err error) {
+	var opts []QueryOption
+	var suffix []string
+	for _, a := range f.annotations {
+		switch a.key {
+		case "cursor":
+			var keys []CursorKey
+			for _, item := range splitList(a.value) {
+				fields := strings.Fields(item)
+				if len(fields) == 0 || len(fields) > 2 {
+					return q, fmt.Errorf("cursor annotation must be columns each with an optional order, got %q", a.value)
+				}
+				order := Ascending
+				if len(fields) == 2 {
+					order = Order(strings.ToUpper(fields[1]))
+					if order != Ascending && order != Descending {
+						return q, fmt.Errorf("cursor order must be asc or desc, got %q", fields[1])
+					}
+				}
+				keys = append(keys, CursorKey{Column: fields[0], Order: order})
+			}
+			if len(keys) == 0 {
+				return q, errors.New("cursor annotation must name at least one column")
+			}
+			opts = append(opts, WithCursorColumns(keys...))
+		case "insert-columns":
+			opts = append(opts, WithInsertColumnNames(splitList(a.value)...))
+		case "unnest":
+			opts = append(opts, WithUnnest(splitList(a.value)...))
+		case "on-conflict":
+			opt, err := parseOnConflict(a.value)
+			if err != nil {
+				return q, err
+			}
+			opts = append(opts, opt)
+		case "timeout", "statement-timeout":
+			timeout, err := time.ParseDuration(a.value)
+			if err != nil {
+				return q, fmt.Errorf("invalid %s annotation: %w", a.key, err)
+			}
+			if a.key == "timeout" {
+				opts = append(opts, WithTimeout(timeout))
+			} else {
+				opts = append(opts, WithStatementTimeout(timeout))
+			}
+		case "lock":
+			opt, err := parseLock(a.value)
+			if err != nil {
+				return q, err
+			}
+			opts = append(opts, opt)
+		case "suffix":
+			suffix = append(suffix, a.value)
+		default:
+			return q, fmt.Errorf("unknown annotation %q", a.key)
+		}
+	}
+	if len(suffix) > 0 {
+		opts = append(opts, WithSuffix(strings.Join(suffix, "\n")))
+	}
+
+	body := strings.TrimRight(strings.TrimSpace(stripComments(f.body.String())), "; \t\n")
+	if body == "" {
+		return q, fmt.Errorf("query %q is empty", f.name)
+	}
+
+	// Options such as on-conflict panic from newQuery when misconfigured,
+	// which should be reported as a parse error instead.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return newQuery(f.name, body, opts...), nil
+}
+
+// parseOnConflict parses an on-conflict annotation such as
+// "sku do update set price, quantity".
+func parseOnConflict(value string) (QueryOption, error) {
+	lower := strings.ToLower(value)
+	i := strings.Index(lower, "do ")
+	if i < 0 {
+		return nil, fmt.Errorf("on-conflict annotation must contain do nothing or do update, got %q", value)
+	}
+	target := splitList(strings.Trim(strings.TrimSpace(value[:i]), "()"))
+	action := strings.Fields(lower[i:])
+
+	switch {
+	case len(action) == 2 && action[1] == "nothing":
+		return WithOnConflictDoNothing(target...), nil
+	case len(action) >= 2 && action[1] == "update":
+		var update []string
+		if len(action) > 2 {
+			if action[2] != "set" {
+				return nil, fmt.Errorf("on-conflict annotation must list update columns after set, got %q", value)
+			}
+			rest := strings.TrimSpace(value[i:])
+			update = splitList(rest[strings.Index(strings.ToLower(rest), "set")+len("set"):])
+		}
+		return WithOnConflictDoUpdate(target, update...), nil
+	default:
+		return nil, fmt.Errorf("on-conflict annotation must contain do nothing or do update, got %q", value)
+	}
+}
+
+// parseLock parses a lock annotation such as "for no key update nowait".
+func parseLock(value string) (QueryOption, error) {
+	clause := strings.ToUpper(strings.Join(strings.Fields(value), " "))
+	for _, wait := range []LockWait{NoWait, SkipLocked} {
+		if !strings.HasSuffix(clause, " "+string(wait)) {
+			continue
+		}
+		strength := LockStrength(strings.TrimSuffix(clause, " "+string(wait)))
+		if !validLockStrength(strength) {
+			break
+		}
+		return WithLocking(strength, wait), nil
+	}
+
+	strength := LockStrength(clause)
+	if !validLockStrength(strength) {
+		return nil, fmt.Errorf("invalid lock annotation %q", value)
+	}
+	return WithLocking(strength, Wait), nil
+}
+
+func validLockStrength(strength LockStrength) bool {
+	switch strength {
+	case ForUpdate, ForNoKeyUpdate, ForShare, ForKeyShare:
+		return true
+	}
+	return false
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
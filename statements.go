@@ -0,0 +1,198 @@
+package pge
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+
+	pgx "github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// StatementMode controls how queries are prepared on the server.
+type StatementMode int
+
+const (
+	// ImplicitStatements leaves preparing statements to pgx, which prepares
+	// and caches every query under a generated name on each connection. This
+	// is the default.
+	ImplicitStatements StatementMode = iota
+
+	// NamedStatements prepares every query as a named server-side statement
+	// derived from Query.Name, cached per connection.
+	NamedStatements
+
+	// UnnamedStatements only prepares the unnamed statement to describe each
+	// query, caching the description on the client, so that no server-side
+	// statement outlives a single query. This is required when connecting
+	// through pgbouncer in transaction pooling mode.
+	UnnamedStatements
+)
+
+const defaultStatementCacheCapacity = 512
+
+// maxIdentifierLength is the longest identifier postgres accepts without
+// truncation (NAMEDATALEN - 1).
+const maxIdentifierLength = 63
+
+var statementNameReplacer = strings.NewReplacer(" ", "_", "-", "_", ".", "_")
+
+// statementCache tracks the named statements prepared on each connection and
+// evicts the least recently used ones once a connection reaches capacity.
+type statementCache struct {
+	capacity int
+
+	mu    sync.Mutex
+	conns map[*pgx.Conn]*statementLRU
+}
+
+type statementLRU struct {
+	ll    *list.List
+	elems map[string]*list.Element
+}
+
+func newStatementCache(capacity int) *statementCache {
+	return &statementCache{
+		capacity: capacity,
+		conns:    make(map[*pgx.Conn]*statementLRU),
+	}
+}
+
+// prepare ensures a named statement for sql exists on conn and returns its
+// name, deallocating any statements evicted to make room for it.
+func (c *statementCache) prepare(ctx context.Context, conn *pgx.Conn, query Query, sql string) (string, error) {
+	name := statementName(query, sql)
+	evicted := c.touch(conn, name)
+	for _, stmt := range evicted {
+		err := conn.Deallocate(ctx, stmt)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	_, err := conn.Prepare(ctx, name, sql)
+	if err != nil {
+		c.forget(conn, name)
+		return "", err
+	}
+	return name, nil
+}
+
+func (c *statementCache) touch(conn *pgx.Conn, name string) (evicted []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	lru, ok := c.conns[conn]
+	if !ok {
+		// Connections are only ever added here, so sweep the ones the pool
+		// has since closed to keep the map bounded.
+		for other := range c.conns {
+			if other.IsClosed() {
+				delete(c.conns, other)
+			}
+		}
+		lru = &statementLRU{
+			ll:    list.New(),
+			elems: make(map[string]*list.Element),
+		}
+		c.conns[conn] = lru
+	}
+
+	if elem, ok := lru.elems[name]; ok {
+		lru.ll.MoveToFront(elem)
+		return nil
+	}
+	lru.elems[name] = lru.ll.PushFront(name)
+
+	for lru.ll.Len() > c.capacity {
+		oldest := lru.ll.Back()
+		stmt := lru.ll.Remove(oldest).(string)
+		delete(lru.elems, stmt)
+		evicted = append(evicted, stmt)
+	}
+	return evicted
+}
+
+func (c *statementCache) forget(conn *pgx.Conn, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	lru, ok := c.conns[conn]
+	if !ok {
+		return
+	}
+	if elem, ok := lru.elems[name]; ok {
+		lru.ll.Remove(elem)
+		delete(lru.elems, name)
+	}
+}
+
+// statementName derives a prepared statement name from the query name, its
+// variant and a hash of the SQL, so that queries sharing a name but rendering
+// to different SQL never collide.
+func statementName(query Query, sql string) string {
+	h := fnv.New32a()
+	h.Write([]byte(sql))
+	suffix := fmt.Sprintf("_%08x", h.Sum32())
+	if query.variant != "" {
+		suffix = "_" + query.variant + suffix
+	}
+
+	name := "pge_" + strings.ToLower(statementNameReplacer.Replace(query.Name))
+	if len(name)+len(suffix) > maxIdentifierLength {
+		name = name[:maxIdentifierLength-len(suffix)]
+	}
+	return name + suffix
+}
+
+// withStatement calls fn with the SQL and arguments to send for query. When
+// named statements are enabled, the query is prepared on a single connection
+// and fn receives the statement name instead, acquiring a connection from the
+// pool if q is not already bound to one.
+func withStatement(ctx context.Context, info *StoreInfo, q queryable, query Query, args []interface{}, fn func(q queryable, sql string, args []interface{}) error) error {
+	return withStatementTimeout(ctx, q, query, func() error {
+		return prepareStatement(ctx, info, q, query, args, fn)
+	})
+}
+
+func prepareStatement(ctx context.Context, info *StoreInfo, q queryable, query Query, args []interface{}, fn func(q queryable, sql string, args []interface{}) error) error {
+	sql, err := query.Render()
+	if err != nil {
+		return err
+	}
+	sql, args, err = expandArgs(sql, query.arguments(args))
+	if err != nil {
+		return err
+	}
+	sql, perCall := info.comment(ctx, query, sql)
+	if perCall {
+		// Preparing statements whose text is unique to one call would only
+		// churn the statement caches, so they are sent unprepared.
+		return fn(q, sql, append([]interface{}{pgx.QuerySimpleProtocol(true)}, args...))
+	}
+	if info == nil || info.statements == nil {
+		return fn(q, sql, args)
+	}
+
+	switch c := q.(type) {
+	case *pgxpool.Pool:
+		return c.AcquireFunc(ctx, func(conn *pgxpool.Conn) error {
+			name, err := info.statements.prepare(ctx, conn.Conn(), query, sql)
+			if err != nil {
+				return err
+			}
+			return fn(conn, name, args)
+		})
+	case interface{ Conn() *pgx.Conn }:
+		name, err := info.statements.prepare(ctx, c.Conn(), query, sql)
+		if err != nil {
+			return err
+		}
+		return fn(q, name, args)
+	default:
+		return fn(q, sql, args)
+	}
+}
@@ -6,17 +6,69 @@ import (
 	"fmt"
 
 	"github.com/jackc/pgconn"
+	"github.com/jackc/pgconn/stmtcache"
 	pgx "github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
 type store struct {
 	pool *pgxpool.Pool
+	info StoreInfo
 }
 
-func NewStore(ctx context.Context, cfg *pgxpool.Config) (Store, error) {
+type StoreOption func(*StoreInfo)
+
+type StoreInfo struct {
+	statementMode          StatementMode
+	statementCacheCapacity int
+	statements             *statementCache
+	comments               bool
+	commentTags            map[string]string
+}
+
+// WithStatementMode sets how queries are prepared on the server. Defaults to
+// ImplicitStatements.
+func WithStatementMode(mode StatementMode) StoreOption {
+	return func(info *StoreInfo) {
+		info.statementMode = mode
+	}
+}
+
+// WithStatementCacheCapacity sets the maximum number of statements cached on
+// each connection with NamedStatements or UnnamedStatements before the least
+// recently used are evicted.
+func WithStatementCacheCapacity(capacity int) StoreOption {
+	return func(info *StoreInfo) {
+		info.statementCacheCapacity = capacity
+	}
+}
+
+func NewStore(ctx context.Context, cfg *pgxpool.Config, opts ...StoreOption) (Store, error) {
+	info := StoreInfo{
+		statementCacheCapacity: defaultStatementCacheCapacity,
+	}
+	for _, opt := range opts {
+		opt(&info)
+	}
+
+	cfg = cfg.Copy()
+	switch info.statementMode {
+	case NamedStatements:
+		if info.statementCacheCapacity > 0 {
+			info.statements = newStatementCache(info.statementCacheCapacity)
+		}
+	case UnnamedStatements:
+		capacity := info.statementCacheCapacity
+		if capacity <= 0 {
+			capacity = defaultStatementCacheCapacity
+		}
+		cfg.ConnConfig.BuildStatementCache = func(conn *pgconn.PgConn) stmtcache.Cache {
+			return stmtcache.New(conn, stmtcache.ModeDescribe, capacity)
+		}
+	}
+
 	conn, err := pgxpool.ConnectConfig(ctx, cfg)
-	return &store{pool: conn}, err
+	return &store{pool: conn, info: info}, err
 }
 
 func (s *store) Close() error {
@@ -86,7 +138,7 @@ func (s *store) Tx(ctx context.Context, fn func(tx Tx) error, opts ...TxOption)
 	}
 	defer sqlTx.Rollback(ctx)
 
-	err = fn(tx{Tx: sqlTx})
+	err = fn(tx{Tx: sqlTx, info: &s.info})
 	if err != nil {
 		return err
 	}
@@ -95,17 +147,25 @@ func (s *store) Tx(ctx context.Context, fn func(tx Tx) error, opts ...TxOption)
 }
 
 func (s *store) Execute(ctx context.Context, query Query, args ...interface{}) (pgconn.CommandTag, error) {
-	return pgExec(ctx, s.pool, query, args...)
+	return pgExec(ctx, &s.info, s.pool, query, args...)
 }
 
 func (s *store) Get(ctx context.Context, dst interface{}, query Query, args ...interface{}) error {
-	return pgGet(ctx, s.pool, dst, query, args...)
+	return pgGet(ctx, &s.info, s.pool, dst, query, args...)
 }
 
 func (s *store) Select(ctx context.Context, dst interface{}, query Query, args ...interface{}) error {
-	return pgSelect(ctx, s.pool, dst, query, args...)
+	return pgSelect(ctx, &s.info, s.pool, dst, query, args...)
+}
+
+func (s *store) PaginatedSelect(ctx context.Context, dst interface{}, query Query, args ...interface{}) (PageInfo, error) {
+	return pgPaginatedSelect(ctx, &s.info, s.pool, dst, query, args...)
+}
+
+func (s *store) Insert(ctx context.Context, dst interface{}, query Query, src interface{}) error {
+	return pgInsert(ctx, &s.info, s.pool, dst, query, src)
 }
 
-func (s *store) PaginatedSelect(ctx context.Context, dst interface{}, query Query, args ...interface{}) (Cursors, error) {
-	return pgPaginatedSelect(ctx, s.pool, dst, query, args...)
+func (s *store) BulkInsert(ctx context.Context, numRows int, query Query, fn func(int) []interface{}) ([]interface{}, error) {
+	return pgBulkInsert(ctx, &s.info, s.pool, numRows, query, fn)
 }
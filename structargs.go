@@ -0,0 +1,103 @@
+package pge
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// structFieldsCache maps a struct type to the index of the field backing each
+// column name.
+var structFieldsCache sync.Map
+
+// StructArgs returns the arguments for an insert query declared with
+// WithInsertColumnNames, read from the fields of src in column order. Fields
+// are matched to columns by their `db` tag, or their name in snake_case when
+// untagged. It is an error for a column to have no matching field.
+func StructArgs(query Query, src interface{}) ([]interface{}, error) {
+	cols := query.InsertColumnNames()
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("query %q does not declare insert column names", query.Name)
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(src))
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expected a struct or pointer to a struct, got %T", src)
+	}
+
+	fields := structFields(v.Type())
+	args := make([]interface{}, len(cols))
+	for i, col := range cols {
+		index, ok := fields[col]
+		if !ok {
+			return nil, fmt.Errorf("%s has no field for column %q", v.Type(), col)
+		}
+		args[i] = v.FieldByIndex(index).Interface()
+	}
+	return args, nil
+}
+
+func structFields(t reflect.Type) map[string][]int {
+	if fields, ok := structFieldsCache.Load(t); ok {
+		return fields.(map[string][]int)
+	}
+
+	fields := make(map[string][]int)
+	collectStructFields(t, nil, fields)
+	structFieldsCache.Store(t, fields)
+	return fields
+}
+
+func collectStructFields(t reflect.Type, prefix []int, fields map[string][]int) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		tag, hasTag := field.Tag.Lookup("db")
+		tag = strings.Split(tag, ",")[0]
+		if tag == "-" {
+			continue
+		}
+
+		index := make([]int, 0, len(prefix)+1)
+		index = append(index, prefix...)
+		index = append(index, i)
+
+		// Embedded structs contribute their fields as if they were declared
+		// on the outer struct. Embedded pointers are skipped since they may
+		// be nil.
+		if field.Anonymous && !hasTag && field.Type.Kind() == reflect.Struct {
+			collectStructFields(field.Type, index, fields)
+			continue
+		}
+
+		col := tag
+		if !hasTag {
+			col = toSnakeCase(field.Name)
+		}
+		if _, ok := fields[col]; !ok {
+			fields[col] = index
+		}
+	}
+}
+
+// toSnakeCase converts a Go field name such as CustomerID to customer_id.
+func toSnakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
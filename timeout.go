@@ -0,0 +1,93 @@
+package pge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgconn"
+	pgx "github.com/jackc/pgx/v4"
+)
+
+// queryCanceled is the SQLSTATE of statements canceled by statement_timeout.
+const queryCanceled = "57014"
+
+// WithTimeout bounds how long the query may run by applying a deadline to the
+// context it is executed with.
+func WithTimeout(timeout time.Duration) QueryOption {
+	return func(q *Query) {
+		q.timeout = timeout
+	}
+}
+
+// WithStatementTimeout is like WithTimeout, but inside a transaction it also
+// sets statement_timeout with SET LOCAL so that the server cancels the query
+// itself. The previous statement_timeout is restored once the query
+// succeeds.
+func WithStatementTimeout(timeout time.Duration) QueryOption {
+	return func(q *Query) {
+		q.timeout = timeout
+		q.statementTimeout = true
+	}
+}
+
+// Timeout returns the timeout set by WithTimeout or WithStatementTimeout.
+func (q Query) Timeout() time.Duration {
+	return q.timeout
+}
+
+// withTimeout runs f with the query's deadline applied to ctx, reporting
+// errors caused by the deadline or statement_timeout as timeouts.
+func withTimeout(ctx context.Context, query Query, f func(context.Context) error) error {
+	if query.timeout <= 0 {
+		return f(ctx)
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, query.timeout)
+	defer cancel()
+
+	err := f(timeoutCtx)
+	if err == nil {
+		return nil
+	}
+
+	var pgErr *pgconn.PgError
+	if (ctx.Err() == nil && errors.Is(timeoutCtx.Err(), context.DeadlineExceeded)) ||
+		(query.statementTimeout && errors.As(err, &pgErr) && pgErr.Code == queryCanceled) {
+		return wrapSentinel(ErrQueryTimeout, fmt.Sprintf("%s after %s", ErrQueryTimeout, query.timeout), err)
+	}
+	return err
+}
+
+// withStatementTimeout runs f with statement_timeout set to the query's
+// timeout when q is a transaction.
+func withStatementTimeout(ctx context.Context, q queryable, query Query, f func() error) error {
+	tx, ok := q.(pgx.Tx)
+	if !ok || !query.statementTimeout || query.timeout <= 0 {
+		return f()
+	}
+
+	var previous string
+	err := tx.QueryRow(ctx, `
+		SELECT current_setting('statement_timeout'), set_config('statement_timeout', $1, true)
+	`, statementTimeoutSetting(query.timeout)).Scan(&previous, nil)
+	if err != nil {
+		return err
+	}
+
+	err = f()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "SELECT set_config('statement_timeout', $1, true)", previous)
+	return err
+}
+
+// statementTimeoutSetting formats timeout as a statement_timeout value,
+// rounded up to whole milliseconds since a timeout of 0 disables it.
+func statementTimeoutSetting(timeout time.Duration) string {
+	ms := (timeout + time.Millisecond - 1) / time.Millisecond
+	return fmt.Sprintf("%dms", ms)
+}
@@ -0,0 +1,21 @@
+package pge
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatementTimeoutSetting(t *testing.T) {
+	for timeout, want := range map[time.Duration]string{
+		time.Nanosecond:                    "1ms",
+		999 * time.Microsecond:             "1ms",
+		time.Millisecond:                   "1ms",
+		time.Millisecond + time.Nanosecond: "2ms",
+		1500 * time.Millisecond:            "1500ms",
+		time.Minute:                        "60000ms",
+	} {
+		if got := statementTimeoutSetting(timeout); got != want {
+			t.Errorf("statementTimeoutSetting(%s) = %q, want %q", timeout, got, want)
+		}
+	}
+}
@@ -10,22 +10,31 @@ import (
 
 type tx struct {
 	pgx.Tx
+	info *StoreInfo
 }
 
 func (t tx) Execute(ctx context.Context, query Query, args ...interface{}) (pgconn.CommandTag, error) {
-	return pgExec(ctx, t.Tx, query, args...)
+	return pgExec(ctx, t.info, t.Tx, query, args...)
 }
 
 func (t tx) Get(ctx context.Context, dst interface{}, query Query, args ...interface{}) error {
-	return pgGet(ctx, t.Tx, dst, query, args...)
+	return pgGet(ctx, t.info, t.Tx, dst, query, args...)
 }
 
 func (t tx) Select(ctx context.Context, dst interface{}, query Query, args ...interface{}) error {
-	return pgSelect(ctx, t.Tx, dst, query, args...)
+	return pgSelect(ctx, t.info, t.Tx, dst, query, args...)
 }
 
-func (t tx) PaginatedSelect(ctx context.Context, dst interface{}, query Query, args ...interface{}) (Cursors, error) {
-	return pgPaginatedSelect(ctx, t.Tx, dst, query, args...)
+func (t tx) PaginatedSelect(ctx context.Context, dst interface{}, query Query, args ...interface{}) (PageInfo, error) {
+	return pgPaginatedSelect(ctx, t.info, t.Tx, dst, query, args...)
+}
+
+func (t tx) Insert(ctx context.Context, dst interface{}, query Query, src interface{}) error {
+	return pgInsert(ctx, t.info, t.Tx, dst, query, src)
+}
+
+func (t tx) BulkInsert(ctx context.Context, numRows int, query Query, fn func(int) []interface{}) ([]interface{}, error) {
+	return pgBulkInsert(ctx, t.info, t.Tx, numRows, query, fn)
 }
 
 type TxOption func(*TxInfo)
@@ -15,6 +15,13 @@ type Store interface {
 	Migrate(ctx context.Context, migrations []Migration) error
 
 	Tx(ctx context.Context, fn func(tx Tx) error, opts ...TxOption) error
+
+	// Explain returns the plan postgres chooses for the query.
+	Explain(ctx context.Context, query Query, args ...interface{}) (*Plan, error)
+
+	// ExplainAnalyze executes the query inside a transaction that is rolled
+	// back, and returns its plan with actual row counts and timings.
+	ExplainAnalyze(ctx context.Context, query Query, args ...interface{}) (*Plan, error)
 }
 
 type Tx interface {
@@ -29,5 +36,17 @@ type Conn interface {
 
 	Select(ctx context.Context, dst interface{}, query Query, args ...interface{}) error
 
-	PaginatedSelect(ctx context.Context, dst interface{}, query Query, args ...interface{}) (Cursors, error)
+	// PaginatedSelect selects the page of rows described by the query's
+	// Paginator into dst, and returns the cursors of neighbouring pages.
+	PaginatedSelect(ctx context.Context, dst interface{}, query Query, args ...interface{}) (PageInfo, error)
+
+	// Insert executes an insert query with arguments read from src by
+	// StructArgs. When src is a slice of structs, its rows are inserted in
+	// batches and any returned rows are appended to dst, which must then be a
+	// pointer to a slice. dst may be nil if the query returns nothing.
+	Insert(ctx context.Context, dst interface{}, query Query, src interface{}) error
+
+	// BulkInsert inserts numRows rows in batches as the BulkInsert function
+	// does, calling fn for the arguments of each row.
+	BulkInsert(ctx context.Context, numRows int, query Query, fn func(int) []interface{}) ([]interface{}, error)
 }
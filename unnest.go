@@ -0,0 +1,152 @@
+package pge
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// unnestBatchSize is the number of rows inserted by each statement of a bulk
+// insert using unnest. It is only bounded to limit the size of each round
+// trip, since the statement has one parameter per column.
+const unnestBatchSize = 1000
+
+// WithUnnest makes an insert query take one array per column, expanded into
+// rows with unnest, instead of generating VALUES with a placeholder for each
+// row and column:
+//
+//	INSERT INTO products (product_name, price)
+//	SELECT * FROM unnest($1::text[], $2::int8[])
+//
+// Every batch size shares the same SQL, and so the same prepared statement,
+// and batches are not limited by the 65535 parameters postgres allows.
+// types are the postgres types of the insert columns, in order. Insert and
+// BulkInsert transpose rows into arrays automatically.
+func WithUnnest(types ...string) QueryOption {
+	return func(q *Query) {
+		q.unnestTypes = types
+	}
+}
+
+// UnnestTypes returns the column types declared by WithUnnest.
+func (q Query) UnnestTypes() []string {
+	return q.unnestTypes
+}
+
+func (q *Query) validateUnnest() error {
+	if len(q.unnestTypes) > 0 && len(q.unnestTypes) != q.insertCols {
+		return fmt.Errorf("query %q declares %d unnest types for %d insert columns", q.Name, len(q.unnestTypes), q.insertCols)
+	}
+	return nil
+}
+
+// withUnnest returns the insert query selecting its rows from unnest.
+func (q Query) withUnnest() Query {
+	return q.withComposition(q.unnestQuery(), 0)
+}
+
+func (q Query) unnestQuery() Query {
+	if q.cache == nil {
+		return q.buildUnnest()
+	}
+
+	key := "unnest\x00" + q.prefix + "\x00" + q.suffix
+	if unnest, ok := q.cache.values.Load(key); ok {
+		return unnest.(Query)
+	}
+	unnest := q.buildUnnest()
+	q.cache.values.Store(key, unnest)
+	return unnest
+}
+
+func (q Query) buildUnnest() Query {
+	var b strings.Builder
+	b.WriteString(collapseSpace(q.prefix))
+	b.WriteString(collapseSpace(q.query))
+	if len(q.insertColNames) > 0 {
+		b.WriteString(" (")
+		b.WriteString(strings.Join(q.insertColNames, ", "))
+		b.WriteString(")")
+	}
+
+	b.WriteString(" SELECT * FROM unnest(")
+	for i, typ := range q.unnestTypes {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("$")
+		b.WriteString(strconv.Itoa(i + 1))
+		b.WriteString("::")
+		b.WriteString(typ)
+		b.WriteString("[]")
+	}
+	b.WriteString(")")
+
+	if q.onConflict != nil {
+		b.WriteString(" ")
+		b.WriteString(q.onConflict.String())
+	}
+	b.WriteString(" ")
+	b.WriteString(collapseSpace(q.suffix))
+
+	unnest := newQuery(q.Name, b.String())
+	unnest.file, unnest.line = q.file, q.line
+	unnest.variant = "unnest"
+	return unnest
+}
+
+// insertBatch returns the query and arguments that insert rows, each holding
+// the arguments of one row.
+func (q Query) insertBatch(rows [][]interface{}) (Query, []interface{}, error) {
+	if len(q.unnestTypes) > 0 {
+		args, err := transpose(rows, len(q.unnestTypes))
+		return q, args, err
+	}
+
+	var args []interface{}
+	for _, row := range rows {
+		args = append(args, row...)
+	}
+	return q.WithValues(len(rows)), args, nil
+}
+
+func (q Query) insertBatchSize() int {
+	if len(q.unnestTypes) > 0 {
+		return unnestBatchSize
+	}
+	return bulkBatchSize
+}
+
+// transpose turns rows of arguments into one array per column. Columns are
+// left as []interface{} so that nil values are sent as NULL elements, which
+// pgx converts to the array type of the column's unnest parameter. Non-nil
+// values in a column must share a type, ignoring pointers.
+func transpose(rows [][]interface{}, cols int) ([]interface{}, error) {
+	arrays := make([]interface{}, cols)
+	for j := 0; j < cols; j++ {
+		var elem reflect.Type
+		array := make([]interface{}, len(rows))
+		for i, row := range rows {
+			if len(row) != cols {
+				return nil, fmt.Errorf("row %d has %d values for %d columns", i, len(row), cols)
+			}
+			array[i] = row[j]
+
+			v := reflect.ValueOf(row[j])
+			for v.Kind() == reflect.Ptr && !v.IsNil() {
+				v = v.Elem()
+			}
+			if !v.IsValid() || v.Kind() == reflect.Ptr {
+				continue
+			}
+			if elem == nil {
+				elem = v.Type()
+			} else if v.Type() != elem {
+				return nil, fmt.Errorf("column %d mixes %s and %s values in row %d", j+1, elem, v.Type(), i)
+			}
+		}
+		arrays[j] = array
+	}
+	return arrays, nil
+}
@@ -0,0 +1,98 @@
+package pge
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WithInsertColumnNames declares the columns of an insert query by name.
+// The column list is generated from the names, so the query should stop at
+// the table name:
+//
+//	pge.NewQuery("insert product", `INSERT INTO products`,
+//		pge.WithInsertColumnNames("product_name", "price", "quantity"))
+func WithInsertColumnNames(cols ...string) QueryOption {
+	return func(q *Query) {
+		q.insertColNames = cols
+		q.insertCols = len(cols)
+	}
+}
+
+// WithOnConflictDoUpdate adds `ON CONFLICT (target) DO UPDATE` to an insert
+// query, setting each update column to its EXCLUDED value. When no update
+// columns are given, every named insert column outside of target is updated.
+func WithOnConflictDoUpdate(target []string, update ...string) QueryOption {
+	return func(q *Query) {
+		q.onConflict = &onConflict{target: target, update: update, doUpdate: true}
+	}
+}
+
+// WithOnConflictDoNothing adds `ON CONFLICT (target) DO NOTHING` to an insert
+// query. The target may be omitted to ignore conflicts on any constraint.
+func WithOnConflictDoNothing(target ...string) QueryOption {
+	return func(q *Query) {
+		q.onConflict = &onConflict{target: target}
+	}
+}
+
+type onConflict struct {
+	target   []string
+	update   []string
+	doUpdate bool
+}
+
+// InsertColumnNames returns the column names declared by
+// WithInsertColumnNames.
+func (q Query) InsertColumnNames() []string {
+	return q.insertColNames
+}
+
+// validateOnConflict resolves the columns updated on conflict once all
+// options have been applied.
+func (q *Query) validateOnConflict() error {
+	c := q.onConflict
+	if c == nil || !c.doUpdate || len(c.update) > 0 {
+		return nil
+	}
+
+	targets := make(map[string]bool, len(c.target))
+	for _, col := range c.target {
+		targets[col] = true
+	}
+	var update []string
+	for _, col := range q.insertColNames {
+		if !targets[col] {
+			update = append(update, col)
+		}
+	}
+	if len(update) == 0 {
+		return fmt.Errorf("query %q has no columns to update on conflict", q.Name)
+	}
+	q.onConflict = &onConflict{target: c.target, update: update, doUpdate: true}
+	return nil
+}
+
+func (c *onConflict) String() string {
+	var b strings.Builder
+	b.WriteString("ON CONFLICT")
+	if len(c.target) > 0 {
+		b.WriteString(" (")
+		b.WriteString(strings.Join(c.target, ", "))
+		b.WriteString(")")
+	}
+	if !c.doUpdate {
+		b.WriteString(" DO NOTHING")
+		return b.String()
+	}
+
+	b.WriteString(" DO UPDATE SET ")
+	for i, col := range c.update {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(col)
+		b.WriteString(" = EXCLUDED.")
+		b.WriteString(col)
+	}
+	return b.String()
+}